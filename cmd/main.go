@@ -2,51 +2,341 @@ package main
 
 import (
     "context"
-    "log"
+    "errors"
+    "flag"
+    "fmt"
+    "log/slog"
+    "net"
+    "net/http"
     "os"
     "os/signal"
+    "strings"
     "syscall"
     "time"
 
+    "proxy-system/internal/api"
+    "proxy-system/internal/client"
     "proxy-system/internal/config"
+    "proxy-system/internal/gateway"
+    "proxy-system/internal/judge"
+    "proxy-system/internal/lease"
     "proxy-system/internal/service"
+    "proxy-system/internal/storage"
 )
 
 func main() {
+    // JSON logs at info until the configured level is known
+    logLevel := new(slog.LevelVar)
+    slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})))
+
+    // Exit non-zero after the deferred cleanup if anything failed. Once
+    // cleanup has been deferred, errors go through fail and return instead of
+    // calling fatal, which would skip it.
+    var failed bool
+    defer func() {
+        if failed {
+            os.Exit(1)
+        }
+    }()
+    fail := func(msg string, err error, args ...interface{}) {
+        slog.Error(msg, append(args, "error", err)...)
+        failed = true
+    }
+
+    // The first argument may name a command, run is the default
+    command, args := "run", os.Args[1:]
+    if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+        command, args = args[0], args[1:]
+    }
+
     // Load configuration
-    cfg, err := config.Load()
+    cfg, err := config.Load(args)
+    if errors.Is(err, flag.ErrHelp) {
+        return
+    }
     if err != nil {
-        log.Fatalf("Failed to load configuration: %v", err)
+        fatal("Failed to load configuration", err)
+    }
+    logLevel.Set(cfg.LogLevel)
+
+    switch command {
+    case "run":
+    case "config":
+        // Print the effective configuration and exit
+        if err := cfg.WriteEffective(os.Stdout); err != nil {
+            fatal("Failed to print configuration", err)
+        }
+        return
+    default:
+        fatal("Unknown command", fmt.Errorf("%s (expected run or config)", command))
     }
 
-    log.Printf("Starting PMS")
+    slog.Info("Starting PMS")
+
+    // Every step of shutdown shares one SHUTDOWN_TIMEOUT deadline
+    deadline := &shutdownDeadline{timeout: cfg.ShutdownTimeout}
+    defer deadline.stop()
+
+    // Start the embedded anonymity judge
+    if cfg.JudgeListenAddr != "" {
+        judgeServer, err := judge.Start(cfg.JudgeListenAddr)
+        if err != nil {
+            fail("Failed to start judge", err)
+            return
+        }
+        defer func() {
+            if err := judgeServer.Shutdown(deadline.context()); err != nil {
+                slog.Warn("Judge did not shut down in time", "error", err)
+            }
+        }()
+        slog.Info("Judge listening", "addr", judgeServer.Addr())
+    }
+
+    // Initialize storage
+    store, err := storage.NewProxyStore(cfg)
+    if err != nil {
+        fail("Failed to initialize storage", err, "backend", cfg.StorageBackend)
+        return
+    }
 
     // Initialize service
-    proxyService, err := service.NewProxyService(cfg)
+    proxyService, err := service.NewProxyService(cfg, buildSources(cfg), store)
     if err != nil {
-        log.Fatalf("Failed to initialize proxy service: %v", err)
+        fail("Failed to initialize proxy service", err)
+        return
+    }
+
+    // Start the API
+    if cfg.APIAddr != "" {
+        leases := lease.NewManager(store, cfg.LeaseMaxDuration)
+        apiServer, err := api.Start(cfg.APIAddr, api.NewServer(store, leases))
+        if err != nil {
+            fail("Failed to start API server", err)
+            return
+        }
+        defer func() {
+            if err := apiServer.Shutdown(deadline.context()); err != nil {
+                slog.Warn("API server did not shut down in time", "error", err)
+            }
+        }()
+        slog.Info("API listening", "addr", cfg.APIAddr)
     }
 
     // Create context for graceful shutdown
     ctx, cancel := context.WithCancel(context.Background())
     defer cancel()
 
+    // Start the rotating gateway
+    if cfg.GatewaySOCKSAddr != "" || cfg.GatewayHTTPAddr != "" {
+        if err := startGateway(ctx, cfg, store); err != nil {
+            fail("Failed to start gateway", err)
+            return
+        }
+    }
+
     // Start the service
+    serviceErr := make(chan error, 1)
     go func() {
-        if err := proxyService.Start(ctx); err != nil {
-            log.Fatalf("Proxy service error: %v", err)
-        }
+        serviceErr <- proxyService.Start(ctx)
     }()
 
-    // Wait for interrupt signal
+    // Apply config changes on SIGHUP or when the config file changes
+    go runReloads(ctx, cfg, args, logLevel, proxyService)
+
+    // Wait for an interrupt signal. The service only returns once ctx is
+    // cancelled, so there is nothing else to wait for.
     sigChan := make(chan os.Signal, 1)
     signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-    <-sigChan
 
-    log.Println("Shutting down proxy management system...")
+    sig := <-sigChan
+    slog.Info("Shutting down proxy management system", "signal", sig.String())
     cancel()
-    
-    // Give some time for cleanup
-    time.Sleep(2 * time.Second)
-    log.Println("Proxy management system stopped")
-}
\ No newline at end of file
+
+    // Let in-flight validation and writes finish, up to the shutdown timeout.
+    // The servers are shut down by the deferred calls within what is left.
+    if err := proxyService.Shutdown(deadline.context()); err != nil {
+        slog.Warn("Shutdown timed out, in-flight work abandoned", "timeout", cfg.ShutdownTimeout.String(), "error", err)
+    }
+    if err := <-serviceErr; err != nil {
+        fail("Proxy service error", err)
+    }
+    slog.Info("Proxy management system stopped")
+}
+
+// fatal logs an error and exits. Only for errors before any cleanup is deferred.
+func fatal(msg string, err error, args ...interface{}) {
+    slog.Error(msg, append(args, "error", err)...)
+    os.Exit(1)
+}
+
+// shutdownDeadline hands out a context bounded by the shutdown timeout. The
+// timeout starts the first time the context is asked for, so every step of
+// shutdown after that shares it.
+type shutdownDeadline struct {
+    timeout time.Duration
+    ctx     context.Context
+    cancel  context.CancelFunc
+}
+
+func (d *shutdownDeadline) context() context.Context {
+    if d.ctx == nil {
+        d.ctx, d.cancel = context.WithTimeout(context.Background(), d.timeout)
+    }
+    return d.ctx
+}
+
+func (d *shutdownDeadline) stop() {
+    if d.cancel != nil {
+        d.cancel()
+    }
+}
+
+// runReloads reloads the config on SIGHUP and, when a config file is used,
+// whenever its modification time changes, until ctx is done
+func runReloads(ctx context.Context, cfg *config.Config, args []string, logLevel *slog.LevelVar, proxyService *service.ProxyService) {
+    hup := make(chan os.Signal, 1)
+    signal.Notify(hup, syscall.SIGHUP)
+    defer signal.Stop(hup)
+
+    var poll <-chan time.Time
+    var modTime time.Time
+    if cfg.ConfigFile != "" && cfg.ConfigWatchInterval > 0 {
+        ticker := time.NewTicker(cfg.ConfigWatchInterval)
+        defer ticker.Stop()
+        poll = ticker.C
+        modTime = fileModTime(cfg.ConfigFile)
+    }
+
+    for {
+        var trigger string
+        select {
+        case <-ctx.Done():
+            return
+        case <-hup:
+            trigger = "sighup"
+        case <-poll:
+            latest := fileModTime(cfg.ConfigFile)
+            if latest.Equal(modTime) {
+                continue
+            }
+            modTime = latest
+            trigger = "file"
+        }
+        cfg = reloadConfig(cfg, args, trigger, logLevel, proxyService)
+    }
+}
+
+// reloadConfig loads the config again and applies the settings that can
+// change live, returning the config now in effect. Changes to settings that
+// are only read on startup are logged and ignored.
+func reloadConfig(current *config.Config, args []string, trigger string, logLevel *slog.LevelVar, proxyService *service.ProxyService) *config.Config {
+    logger := slog.With("trigger", trigger)
+
+    next, err := config.Load(args)
+    if err != nil {
+        logger.Error("Config reload failed, keeping the current config", "error", err)
+        return current
+    }
+
+    merged, applied, rejected, err := current.Apply(next)
+    if err != nil {
+        logger.Error("Config reload failed, keeping the current config", "error", err)
+        return current
+    }
+    for _, name := range rejected {
+        logger.Warn("Ignoring config change that needs a restart", "setting", name,
+            "reason", "only read on startup")
+    }
+    if len(applied) == 0 {
+        logger.Info("Config reloaded, no live settings changed")
+        return current
+    }
+
+    if err := proxyService.Reload(merged, buildSources(merged)); err != nil {
+        logger.Error("Config reload failed, keeping the current config", "error", err)
+        return current
+    }
+    logLevel.Set(merged.LogLevel)
+    logger.Info("Config reloaded", "applied", applied)
+    return merged
+}
+
+// fileModTime returns when the file was last modified, or the zero time if
+// it cannot be read
+func fileModTime(path string) time.Time {
+    info, err := os.Stat(path)
+    if err != nil {
+        return time.Time{}
+    }
+    return info.ModTime()
+}
+
+// buildSources creates a ProxySource for every source enabled in the config
+func buildSources(cfg *config.Config) []client.ProxySource {
+    var sources []client.ProxySource
+    if cfg.GeoNodeEnabled {
+        sources = append(sources, client.NewGeoNodeClient(cfg.GeoNodeURL, cfg.FetchTimeout, cfg.GeoNodePageDelay))
+    }
+    for _, list := range cfg.ProxyLists {
+        sources = append(sources, client.NewTextListClient(list.Name, list.URL, list.Protocol, cfg.FetchTimeout))
+    }
+    return sources
+}
+
+// startGateway serves the rotating SOCKS5 and HTTP CONNECT listeners that are
+// configured until ctx is done
+func startGateway(ctx context.Context, cfg *config.Config, store storage.ProxyStore) error {
+    selector, err := gateway.NewSelector(cfg.GatewayStrategy)
+    if err != nil {
+        return err
+    }
+
+    pool := gateway.NewPool(store)
+    if err := pool.Refresh(ctx); err != nil {
+        return fmt.Errorf("failed to load gateway pool: %v", err)
+    }
+    go pool.Run(ctx, cfg.GatewayRefreshInterval)
+
+    gw := gateway.New(pool, selector, gateway.NewMemorySessionStore(), gateway.Options{
+        MaxAttempts: cfg.GatewayMaxAttempts,
+        DialTimeout: cfg.GatewayDialTimeout,
+        SessionTTL:  cfg.GatewaySessionTTL,
+    })
+
+    if cfg.GatewaySOCKSAddr != "" {
+        listener, err := net.Listen("tcp", cfg.GatewaySOCKSAddr)
+        if err != nil {
+            return fmt.Errorf("failed to listen on %s: %v", cfg.GatewaySOCKSAddr, err)
+        }
+        go func() {
+            <-ctx.Done()
+            listener.Close()
+        }()
+        go func() {
+            if err := gw.ServeSOCKS5(ctx, listener); err != nil {
+                slog.Error("Gateway SOCKS5 listener error", "error", err)
+            }
+        }()
+        slog.Info("Gateway SOCKS5 listening", "addr", cfg.GatewaySOCKSAddr, "strategy", cfg.GatewayStrategy)
+    }
+
+    if cfg.GatewayHTTPAddr != "" {
+        listener, err := net.Listen("tcp", cfg.GatewayHTTPAddr)
+        if err != nil {
+            return fmt.Errorf("failed to listen on %s: %v", cfg.GatewayHTTPAddr, err)
+        }
+        server := &http.Server{
+            Handler:           gw,
+            ReadHeaderTimeout: 10 * time.Second,
+            BaseContext:       func(net.Listener) context.Context { return ctx },
+        }
+        go server.Serve(listener)
+        go func() {
+            <-ctx.Done()
+            server.Close()
+        }()
+        slog.Info("Gateway HTTP CONNECT listening", "addr", cfg.GatewayHTTPAddr, "strategy", cfg.GatewayStrategy)
+    }
+
+    return nil
+}
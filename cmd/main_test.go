@@ -0,0 +1,65 @@
+package main
+
+import (
+    "log/slog"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "proxy-system/internal/config"
+    "proxy-system/internal/service"
+    "proxy-system/internal/storage"
+)
+
+func TestReloadConfig(t *testing.T) {
+    tests := []struct {
+        name         string
+        file         string
+        wantReplaced bool
+        wantLevel    slog.Level
+    }{
+        {"live setting", "log_level: debug\n", true, slog.LevelDebug},
+        {"restart-only setting", "lease_max_duration: 1h\n", false, slog.LevelInfo},
+        {"live and restart-only", "log_level: debug\nlease_max_duration: 1h\n", true, slog.LevelDebug},
+        {"invalid value rejects the whole reload", "log_level: debug\nupdate_interval: soon\n", false, slog.LevelInfo},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            path := filepath.Join(t.TempDir(), "config.yaml")
+            writeConfig := func(content string) {
+                if err := os.WriteFile(path, []byte("storage_backend: memory\n"+content), 0o600); err != nil {
+                    t.Fatal(err)
+                }
+            }
+            writeConfig("")
+            args := []string{"-config", path}
+
+            current, err := config.Load(args)
+            if err != nil {
+                t.Fatal(err)
+            }
+            proxyService, err := service.NewProxyService(current, buildSources(current), storage.NewMemoryStorage(current.ProxyTTL))
+            if err != nil {
+                t.Fatal(err)
+            }
+            logLevel := new(slog.LevelVar)
+            logLevel.Set(current.LogLevel)
+
+            writeConfig(tt.file)
+            got := reloadConfig(current, args, "test", logLevel, proxyService)
+
+            if replaced := got != current; replaced != tt.wantReplaced {
+                t.Errorf("config replaced = %v, want %v", replaced, tt.wantReplaced)
+            }
+            if got.LogLevel != tt.wantLevel || logLevel.Level() != tt.wantLevel {
+                t.Errorf("LogLevel = %v, logger at %v, want both %v", got.LogLevel, logLevel.Level(), tt.wantLevel)
+            }
+            // Restart-only settings never change on a reload
+            if got.LeaseMaxDuration != 10*time.Minute {
+                t.Errorf("LeaseMaxDuration = %v, want the startup 10m", got.LeaseMaxDuration)
+            }
+        })
+    }
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+    "fmt"
+    "log/slog"
+    "net/http"
+    "strings"
+    "time"
+
+    "proxy-system/internal/lease"
+    "proxy-system/internal/storage"
+)
+
+// CheckoutResponse is the body returned by POST /leases
+type CheckoutResponse struct {
+    Leases []lease.Lease `json:"leases"`
+}
+
+// handleCheckout serves POST /leases, leasing up to count proxies to owner.
+// Takes owner, count (default 1), duration and the same filters as GET /proxies.
+func (s *Server) handleCheckout(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+
+    query := r.URL.Query()
+
+    filter, err := parseFilter(query)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    owner := strings.TrimSpace(query.Get("owner"))
+    if owner == "" {
+        writeError(w, http.StatusBadRequest, "owner is required")
+        return
+    }
+
+    count, err := parseInt(query.Get("count"), 1, 1, lease.MaxCheckout)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid count: %v", err))
+        return
+    }
+
+    var duration time.Duration
+    if value := query.Get("duration"); value != "" {
+        duration, err = time.ParseDuration(value)
+        if err != nil || duration <= 0 {
+            writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid duration: %s", value))
+            return
+        }
+    }
+
+    leases, err := s.leases.Checkout(r.Context(), owner, filter, count, duration)
+    if err != nil {
+        slog.Error("Failed to check out proxies", "owner", owner, "error", err)
+        writeError(w, http.StatusInternalServerError, "failed to check out proxies")
+        return
+    }
+    if leases == nil {
+        leases = []lease.Lease{}
+    }
+
+    writeJSON(w, http.StatusOK, CheckoutResponse{Leases: leases})
+}
+
+// handleRelease serves DELETE /leases/{ip:port}?owner=...&outcome=success|failure
+func (s *Server) handleRelease(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodDelete {
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+
+    key := strings.TrimPrefix(r.URL.Path, "/leases/")
+    if key == "" || strings.Contains(key, "/") {
+        writeError(w, http.StatusNotFound, "not found")
+        return
+    }
+
+    query := r.URL.Query()
+
+    owner := strings.TrimSpace(query.Get("owner"))
+    if owner == "" {
+        writeError(w, http.StatusBadRequest, "owner is required")
+        return
+    }
+
+    outcome, err := lease.ParseOutcome(query.Get("outcome"))
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    if err := s.leases.Release(r.Context(), owner, key, outcome); err != nil {
+        if err == storage.ErrLeaseNotHeld {
+            writeError(w, http.StatusConflict, err.Error())
+            return
+        }
+        slog.Error("Failed to release lease", "proxy", key, "owner", owner, "error", err)
+        writeError(w, http.StatusInternalServerError, "failed to release lease")
+        return
+    }
+
+    writeJSON(w, http.StatusOK, map[string]string{"status": "released"})
+}
@@ -0,0 +1,388 @@
+package api
+
+import (
+    "container/heap"
+    "encoding/json"
+    "fmt"
+    "log/slog"
+    "math"
+    "net"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "proxy-system/internal/lease"
+    "proxy-system/internal/metrics"
+    "proxy-system/internal/models"
+    "proxy-system/internal/storage"
+)
+
+const (
+    defaultPageSize = 50
+    maxPageSize     = 1000
+
+    // listCacheTTL is how long the proxies matching a filter are reused, so
+    // paging through a listing queries storage once
+    listCacheTTL = 10 * time.Second
+)
+
+// Server exposes read access to the stored proxies and proxy leasing over HTTP
+type Server struct {
+    storage storage.ProxyStore
+    leases  *lease.Manager
+    mux     *http.ServeMux
+
+    cacheMu   sync.Mutex
+    listCache map[string]cachedList
+}
+
+// cachedList is the result of a QueryProxies call, shared between requests
+// and never modified
+type cachedList struct {
+    proxies []models.ProxyData
+    expires time.Time
+}
+
+func NewServer(store storage.ProxyStore, leases *lease.Manager) *Server {
+    s := &Server{
+        storage:   store,
+        leases:    leases,
+        mux:       http.NewServeMux(),
+        listCache: make(map[string]cachedList),
+    }
+
+    s.mux.HandleFunc("/healthz", s.handleHealth)
+    s.mux.Handle("/metrics", metrics.Handler())
+    s.mux.HandleFunc("/proxies", s.handleListProxies)
+    s.mux.HandleFunc("/proxies/", s.handleGetProxy)
+    s.mux.HandleFunc("/leases", s.handleCheckout)
+    s.mux.HandleFunc("/leases/", s.handleRelease)
+
+    return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    s.mux.ServeHTTP(w, r)
+}
+
+// ListResponse is the body returned by GET /proxies
+type ListResponse struct {
+    Total   int                `json:"total"`
+    Offset  int                `json:"offset"`
+    Limit   int                `json:"limit"`
+    Proxies []models.ProxyData `json:"proxies"`
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+    writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleListProxies serves GET /proxies with optional filters
+// (country, protocol, anonymity, google, max_latency), sorting
+// (sort, order) and pagination (limit, offset)
+func (s *Server) handleListProxies(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+
+    query := r.URL.Query()
+
+    filter, err := parseFilter(query)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    less, err := parseSort(query.Get("sort"), query.Get("order"))
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    limit, err := parseInt(query.Get("limit"), defaultPageSize, 1, maxPageSize)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit: %v", err))
+        return
+    }
+    offset, err := parseInt(query.Get("offset"), 0, 0, -1)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid offset: %v", err))
+        return
+    }
+
+    proxies, err := s.queryProxies(r, filter)
+    if err != nil {
+        slog.Error("Failed to query proxies", "error", err)
+        writeError(w, http.StatusInternalServerError, "failed to query proxies")
+        return
+    }
+
+    writeJSON(w, http.StatusOK, ListResponse{
+        Total:   len(proxies),
+        Offset:  offset,
+        Limit:   limit,
+        Proxies: sortedPage(proxies, less, offset, limit),
+    })
+}
+
+// queryProxies returns the proxies matching the filter, from the cache when
+// the same filter was queried within listCacheTTL
+func (s *Server) queryProxies(r *http.Request, filter storage.ProxyFilter) ([]models.ProxyData, error) {
+    google := ""
+    if filter.Google != nil {
+        google = strconv.FormatBool(*filter.Google)
+    }
+    key := strings.Join([]string{filter.Country, filter.Protocol, filter.Anonymity, google,
+        strconv.FormatFloat(filter.MaxLatencyMs, 'g', -1, 64)}, "|")
+    now := time.Now()
+
+    s.cacheMu.Lock()
+    cached, ok := s.listCache[key]
+    s.cacheMu.Unlock()
+    if ok && now.Before(cached.expires) {
+        return cached.proxies, nil
+    }
+
+    proxies, err := s.storage.QueryProxies(r.Context(), filter)
+    if err != nil {
+        return nil, err
+    }
+
+    s.cacheMu.Lock()
+    for k, entry := range s.listCache {
+        if !now.Before(entry.expires) {
+            delete(s.listCache, k)
+        }
+    }
+    s.listCache[key] = cachedList{proxies: proxies, expires: now.Add(listCacheTTL)}
+    s.cacheMu.Unlock()
+
+    return proxies, nil
+}
+
+// sortedPage returns the page at offset of the proxies in the order given by
+// less, ties keeping their original order. Only the first offset+limit
+// proxies are ordered, and proxies is left untouched.
+func sortedPage(proxies []models.ProxyData, less func(a, b *models.ProxyData) bool, offset, limit int) []models.ProxyData {
+    if offset >= len(proxies) {
+        return []models.ProxyData{}
+    }
+    end := offset + limit
+    if end > len(proxies) {
+        end = len(proxies)
+    }
+
+    before := func(i, j int) bool {
+        if less(&proxies[i], &proxies[j]) {
+            return true
+        }
+        return !less(&proxies[j], &proxies[i]) && i < j
+    }
+
+    // Keep the end first proxies in a max-heap, so the last of them is on top
+    top := &pageHeap{before: before}
+    for i := range proxies {
+        if top.Len() < end {
+            heap.Push(top, i)
+        } else if before(i, top.indexes[0]) {
+            top.indexes[0] = i
+            heap.Fix(top, 0)
+        }
+    }
+
+    sort.Slice(top.indexes, func(a, b int) bool {
+        return before(top.indexes[a], top.indexes[b])
+    })
+    page := make([]models.ProxyData, 0, end-offset)
+    for _, i := range top.indexes[offset:end] {
+        page = append(page, proxies[i])
+    }
+    return page
+}
+
+// pageHeap is a max-heap of proxy indexes by the page order
+type pageHeap struct {
+    indexes []int
+    before  func(i, j int) bool
+}
+
+func (h *pageHeap) Len() int           { return len(h.indexes) }
+func (h *pageHeap) Less(a, b int) bool { return h.before(h.indexes[b], h.indexes[a]) }
+func (h *pageHeap) Swap(a, b int)      { h.indexes[a], h.indexes[b] = h.indexes[b], h.indexes[a] }
+func (h *pageHeap) Push(x interface{}) { h.indexes = append(h.indexes, x.(int)) }
+
+func (h *pageHeap) Pop() interface{} {
+    last := h.indexes[len(h.indexes)-1]
+    h.indexes = h.indexes[:len(h.indexes)-1]
+    return last
+}
+
+// handleGetProxy serves GET /proxies/{ip:port}
+func (s *Server) handleGetProxy(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+
+    key := strings.TrimPrefix(r.URL.Path, "/proxies/")
+    if key == "" || strings.Contains(key, "/") {
+        writeError(w, http.StatusNotFound, "not found")
+        return
+    }
+
+    proxies, err := s.storage.BatchGetProxies(r.Context(), []string{key})
+    if err != nil {
+        slog.Error("Failed to get proxy", "proxy", key, "error", err)
+        writeError(w, http.StatusInternalServerError, "failed to get proxy")
+        return
+    }
+
+    proxy, ok := proxies[key]
+    if !ok {
+        writeError(w, http.StatusNotFound, "proxy not found")
+        return
+    }
+
+    writeJSON(w, http.StatusOK, proxy)
+}
+
+func parseFilter(query map[string][]string) (storage.ProxyFilter, error) {
+    get := func(name string) string {
+        if values := query[name]; len(values) > 0 {
+            return strings.TrimSpace(values[0])
+        }
+        return ""
+    }
+
+    filter := storage.ProxyFilter{
+        Country:   get("country"),
+        Protocol:  get("protocol"),
+        Anonymity: get("anonymity"),
+    }
+
+    if google := get("google"); google != "" {
+        value, err := strconv.ParseBool(google)
+        if err != nil {
+            return filter, fmt.Errorf("invalid google: %s", google)
+        }
+        filter.Google = &value
+    }
+
+    if maxLatency := get("max_latency"); maxLatency != "" {
+        value, err := strconv.ParseFloat(maxLatency, 64)
+        if err != nil || value <= 0 {
+            return filter, fmt.Errorf("invalid max_latency: %s", maxLatency)
+        }
+        filter.MaxLatencyMs = value
+    }
+
+    return filter, nil
+}
+
+// sortKeys maps the sort query parameter to a comparison of two proxies
+var sortKeys = map[string]func(a, b *models.ProxyData) bool{
+    "latency": func(a, b *models.ProxyData) bool {
+        return sortableLatency(a) < sortableLatency(b)
+    },
+    "last_checked": func(a, b *models.ProxyData) bool {
+        return a.LastChecked.Before(b.LastChecked)
+    },
+    "validated_at": func(a, b *models.ProxyData) bool {
+        return a.ValidatedAt.Before(b.ValidatedAt)
+    },
+    "health": func(a, b *models.ProxyData) bool {
+        return a.HealthScore < b.HealthScore
+    },
+    "country": func(a, b *models.ProxyData) bool {
+        return a.Country < b.Country
+    },
+    "key": func(a, b *models.ProxyData) bool {
+        return a.GetKey() < b.GetKey()
+    },
+}
+
+// sortableLatency puts proxies without a known latency last
+func sortableLatency(p *models.ProxyData) float64 {
+    if latency := p.EffectiveLatencyMs(); latency > 0 {
+        return latency
+    }
+    return math.Inf(1)
+}
+
+func parseSort(key, order string) (func(a, b *models.ProxyData) bool, error) {
+    if key == "" {
+        key = "latency"
+    }
+    less, ok := sortKeys[key]
+    if !ok {
+        names := make([]string, 0, len(sortKeys))
+        for name := range sortKeys {
+            names = append(names, name)
+        }
+        sort.Strings(names)
+        return nil, fmt.Errorf("invalid sort: %s (expected one of %s)", key, strings.Join(names, ", "))
+    }
+
+    switch order {
+    case "", "asc":
+        return less, nil
+    case "desc":
+        return func(a, b *models.ProxyData) bool { return less(b, a) }, nil
+    default:
+        return nil, fmt.Errorf("invalid order: %s (expected asc or desc)", order)
+    }
+}
+
+// parseInt parses an integer query parameter, returning def when it is empty.
+// A negative hi means unbounded.
+func parseInt(value string, def, lo, hi int) (int, error) {
+    if value == "" {
+        return def, nil
+    }
+    n, err := strconv.Atoi(value)
+    if err != nil {
+        return 0, err
+    }
+    if n < lo || (hi >= 0 && n > hi) {
+        return 0, fmt.Errorf("%d is out of range", n)
+    }
+    return n, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    if err := json.NewEncoder(w).Encode(body); err != nil {
+        slog.Warn("Failed to write response", "error", err)
+    }
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+    writeJSON(w, status, map[string]string{"error": message})
+}
+
+// Start listens on addr and serves the handler in the background until the
+// returned server is shut down
+func Start(addr string, handler http.Handler) (*http.Server, error) {
+    listener, err := net.Listen("tcp", addr)
+    if err != nil {
+        return nil, fmt.Errorf("failed to listen on %s: %v", addr, err)
+    }
+
+    server := &http.Server{
+        Handler:           handler,
+        ReadHeaderTimeout: 10 * time.Second,
+    }
+
+    go func() {
+        if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+            slog.Error("API server error", "error", err)
+        }
+    }()
+
+    return server, nil
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "math/rand"
+    "net/http"
+    "net/http/httptest"
+    "sort"
+    "testing"
+    "time"
+
+    "proxy-system/internal/models"
+    "proxy-system/internal/storage"
+)
+
+// countingStore counts the QueryProxies calls that reach storage
+type countingStore struct {
+    storage.ProxyStore
+    queries int
+}
+
+func (s *countingStore) QueryProxies(ctx context.Context, filter storage.ProxyFilter) ([]models.ProxyData, error) {
+    s.queries++
+    return s.ProxyStore.QueryProxies(ctx, filter)
+}
+
+func TestSortedPageMatchesFullSort(t *testing.T) {
+    rng := rand.New(rand.NewSource(1))
+    proxies := make([]models.ProxyData, 200)
+    for i := range proxies {
+        proxies[i] = models.ProxyData{
+            IP:          fmt.Sprintf("10.0.0.%d", i),
+            Port:        "8080",
+            Country:     []string{"DE", "FR", "US"}[rng.Intn(3)],
+            HealthScore: float64(rng.Intn(10)) / 10,
+        }
+    }
+
+    for _, key := range []string{"country", "health", "key"} {
+        for _, order := range []string{"asc", "desc"} {
+            less, err := parseSort(key, order)
+            if err != nil {
+                t.Fatal(err)
+            }
+            want := append([]models.ProxyData(nil), proxies...)
+            sort.SliceStable(want, func(i, j int) bool { return less(&want[i], &want[j]) })
+
+            for _, page := range [][2]int{{0, 10}, {35, 20}, {190, 50}, {0, 500}, {300, 10}} {
+                offset, limit := page[0], page[1]
+                got := sortedPage(proxies, less, offset, limit)
+
+                var expected []models.ProxyData
+                if offset < len(want) {
+                    expected = want[offset:min(offset+limit, len(want))]
+                }
+                if len(got) != len(expected) {
+                    t.Fatalf("%s %s offset %d limit %d: got %d proxies, want %d", key, order, offset, limit, len(got), len(expected))
+                }
+                for i := range got {
+                    if got[i].GetKey() != expected[i].GetKey() {
+                        t.Errorf("%s %s offset %d limit %d: proxy %d is %s, want %s", key, order, offset, limit, i, got[i].GetKey(), expected[i].GetKey())
+                        break
+                    }
+                }
+            }
+        }
+    }
+}
+
+func TestListProxiesPagesFromCache(t *testing.T) {
+    memory := storage.NewMemoryStorage(time.Hour)
+    var proxies []models.ProxyData
+    for i := 0; i < 30; i++ {
+        proxies = append(proxies, models.ProxyData{IP: fmt.Sprintf("10.0.0.%d", i), Port: "8080", Country: "US"})
+    }
+    if err := memory.BatchUpsertProxies(context.Background(), proxies); err != nil {
+        t.Fatal(err)
+    }
+    store := &countingStore{ProxyStore: memory}
+    server := NewServer(store, nil)
+
+    seen := make(map[string]bool)
+    for offset := 0; offset < 30; offset += 10 {
+        req := httptest.NewRequest("GET", fmt.Sprintf("/proxies?country=US&sort=key&limit=10&offset=%d", offset), nil)
+        rec := httptest.NewRecorder()
+        server.ServeHTTP(rec, req)
+        if rec.Code != http.StatusOK {
+            t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+        }
+
+        // ProxyData does not decode its own JSON, so only read the keys
+        var response struct {
+            Total   int `json:"total"`
+            Proxies []struct {
+                IP   string `json:"ip"`
+                Port string `json:"port"`
+            } `json:"proxies"`
+        }
+        if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+            t.Fatal(err)
+        }
+        if response.Total != 30 || len(response.Proxies) != 10 {
+            t.Errorf("offset %d: total %d with %d proxies, want 30 with 10", offset, response.Total, len(response.Proxies))
+        }
+        for _, p := range response.Proxies {
+            seen[p.IP+":"+p.Port] = true
+        }
+    }
+
+    if len(seen) != 30 {
+        t.Errorf("pages covered %d distinct proxies, want 30", len(seen))
+    }
+    if store.queries != 1 {
+        t.Errorf("storage was queried %d times for one listing, want 1", store.queries)
+    }
+}
@@ -1,6 +1,7 @@
 package client
 
 import (
+    "context"
     "encoding/json"
     "fmt"
     "io"
@@ -10,25 +11,85 @@ import (
     "proxy-system/internal/models"
 )
 
+// geoNodePageSize is the largest page the GeoNode API will return
+const geoNodePageSize = 500
+
 type GeoNodeClient struct {
     httpClient *http.Client
     baseURL    string
+    pageDelay  time.Duration
 }
 
-func NewGeoNodeClient() *GeoNodeClient {
+func NewGeoNodeClient(baseURL string, timeout, pageDelay time.Duration) *GeoNodeClient {
     return &GeoNodeClient{
         httpClient: &http.Client{
-            Timeout: 15 * time.Second,
+            Timeout: timeout,
         },
-        baseURL: "https://proxylist.geonode.com/api/proxy-list",
+        baseURL:   baseURL,
+        pageDelay: pageDelay,
+    }
+}
+
+func (c *GeoNodeClient) Name() string {
+    return "geonode"
+}
+
+func (c *GeoNodeClient) Capabilities() Capabilities {
+    return Capabilities{
+        MaxLimit:   0,
+        Protocols:  []string{"http", "https", "socks4", "socks5"},
+        Geolocated: true,
+    }
+}
+
+// FetchProxies walks the GeoNode pages until the reported total is reached
+// or limit proxies have been collected. A limit of 0 fetches every page. When
+// a page fails, the proxies from the pages before it are returned along with
+// the error.
+func (c *GeoNodeClient) FetchProxies(ctx context.Context, limit int) ([]models.ProxyData, error) {
+    var proxies []models.ProxyData
+
+    // The page size must stay constant, GeoNode derives the offset from it
+    pageSize := geoNodePageSize
+    if limit > 0 && limit < pageSize {
+        pageSize = limit
+    }
+
+    for page := 1; ; page++ {
+        response, err := c.fetchPage(ctx, page, pageSize)
+        if err != nil {
+            return proxies, fmt.Errorf("page %d: %w", page, err)
+        }
+
+        proxies = append(proxies, response.Data...)
+
+        if len(response.Data) == 0 || len(response.Data) < pageSize {
+            break
+        }
+        if response.Total > 0 && len(proxies) >= response.Total {
+            break
+        }
+        if limit > 0 && len(proxies) >= limit {
+            proxies = proxies[:limit]
+            break
+        }
+
+        // Be polite between pages
+        select {
+        case <-ctx.Done():
+            return proxies, ctx.Err()
+        case <-time.After(c.pageDelay):
+        }
     }
+
+    return proxies, nil
 }
 
-func (c *GeoNodeClient) FetchProxies(limit int) ([]models.ProxyData, error) {
-    url := fmt.Sprintf("%s?protocols=http%%2Chttps%%2Csocks4%%2Csocks5&limit=%d&page=1&sort_by=lastChecked&sort_type=desc",
-        c.baseURL, limit)
+func (c *GeoNodeClient) fetchPage(ctx context.Context, page, pageSize int) (*models.ProxyResponse, error) {
+    url := fmt.Sprintf("%s?protocols=http%%2Chttps%%2Csocks4%%2Csocks5&limit=%d&page=%d&sort_by=lastChecked&sort_type=desc",
+        c.baseURL, pageSize, page)
 
-    req, err := http.NewRequest("GET", url, nil)
+    req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
     if err != nil {
         return nil, fmt.Errorf("failed to create request: %v", err)
     }
@@ -50,7 +111,7 @@ func (c *GeoNodeClient) FetchProxies(limit int) ([]models.ProxyData, error) {
 
     resp, err := c.httpClient.Do(req)
     if err != nil {
-        return nil, fmt.Errorf("failed to fetch proxies: %v", err)
+        return nil, fmt.Errorf("failed to fetch proxies: %w", err)
     }
     defer resp.Body.Close()
 
@@ -81,5 +142,5 @@ func (c *GeoNodeClient) FetchProxies(limit int) ([]models.ProxyData, error) {
         return nil, fmt.Errorf("failed to unmarshal response: %v, body: %s", err, string(body[jsonStart:]))
     }
 
-    return proxyResponse.Data, nil
+    return &proxyResponse, nil
 }
\ No newline at end of file
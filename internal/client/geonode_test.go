@@ -0,0 +1,87 @@
+package client
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+// geoNodePage builds a GeoNode response with n proxies numbered from first
+func geoNodePage(first, n, total int) map[string]interface{} {
+    data := make([]map[string]interface{}, 0, n)
+    for i := first; i < first+n; i++ {
+        data = append(data, map[string]interface{}{
+            "ip":        fmt.Sprintf("10.%d.%d.%d", i>>16&255, i>>8&255, i&255),
+            "port":      "8080",
+            "protocols": []string{"http"},
+        })
+    }
+    return map[string]interface{}{"data": data, "total": total}
+}
+
+func TestGeoNodeFetchProxiesKeepsPagesBeforeFailure(t *testing.T) {
+    const total = 3 * geoNodePageSize
+    var requested []string
+
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        page := r.URL.Query().Get("page")
+        requested = append(requested, page)
+
+        switch page {
+        case "1":
+            json.NewEncoder(w).Encode(geoNodePage(0, geoNodePageSize, total))
+        case "2":
+            http.Error(w, "upstream unavailable", http.StatusBadGateway)
+        default:
+            t.Errorf("page %s requested after page 2 failed", page)
+        }
+    }))
+    defer server.Close()
+
+    c := NewGeoNodeClient(server.URL, 5*time.Second, 0)
+    proxies, err := c.FetchProxies(context.Background(), 0)
+
+    if err == nil {
+        t.Fatal("FetchProxies succeeded, want the page 2 error")
+    }
+    if !strings.Contains(err.Error(), "page 2") || errors.Unwrap(err) == nil {
+        t.Errorf("error = %v, want it to name page 2 and wrap the cause", err)
+    }
+    if len(proxies) != geoNodePageSize {
+        t.Errorf("got %d proxies, want the %d from page 1", len(proxies), geoNodePageSize)
+    }
+    if strings.Join(requested, ",") != "1,2" {
+        t.Errorf("requested pages %v, want 1 and 2", requested)
+    }
+}
+
+func TestGeoNodeFetchProxiesWalksPages(t *testing.T) {
+    const total = geoNodePageSize + 10
+
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch r.URL.Query().Get("page") {
+        case "1":
+            json.NewEncoder(w).Encode(geoNodePage(0, geoNodePageSize, total))
+        case "2":
+            json.NewEncoder(w).Encode(geoNodePage(geoNodePageSize, 10, total))
+        default:
+            http.NotFound(w, r)
+        }
+    }))
+    defer server.Close()
+
+    c := NewGeoNodeClient(server.URL, 5*time.Second, 0)
+    proxies, err := c.FetchProxies(context.Background(), 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(proxies) != total {
+        t.Errorf("got %d proxies, want %d", len(proxies), total)
+    }
+}
@@ -0,0 +1,25 @@
+package client
+
+import (
+    "context"
+
+    "proxy-system/internal/models"
+)
+
+// ProxySource is anything that can feed proxies into the update cycle
+type ProxySource interface {
+    // Name identifies the source in logs
+    Name() string
+    // FetchProxies returns up to limit proxies from the source. A source that
+    // fails partway may return what it got so far along with the error.
+    FetchProxies(ctx context.Context, limit int) ([]models.ProxyData, error)
+    // Capabilities describes what the source can provide
+    Capabilities() Capabilities
+}
+
+// Capabilities describes the data a ProxySource is able to return
+type Capabilities struct {
+    MaxLimit   int      // Largest limit honoured by a single fetch, 0 if unbounded
+    Protocols  []string // Protocols the source can return
+    Geolocated bool     // Whether proxies carry country/city/ASN data
+}
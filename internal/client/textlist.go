@@ -0,0 +1,105 @@
+package client
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "strings"
+    "time"
+
+    "proxy-system/internal/models"
+)
+
+// TextListClient fetches plain-text proxy lists with one ip:port per line.
+// Every entry is assumed to speak the single protocol the list was configured with.
+type TextListClient struct {
+    httpClient *http.Client
+    name       string
+    url        string
+    protocol   string
+}
+
+func NewTextListClient(name, url, protocol string, timeout time.Duration) *TextListClient {
+    return &TextListClient{
+        httpClient: &http.Client{
+            Timeout: timeout,
+        },
+        name:     name,
+        url:      url,
+        protocol: protocol,
+    }
+}
+
+func (c *TextListClient) Name() string {
+    return c.name
+}
+
+func (c *TextListClient) Capabilities() Capabilities {
+    return Capabilities{
+        Protocols: []string{c.protocol},
+    }
+}
+
+func (c *TextListClient) FetchProxies(ctx context.Context, limit int) ([]models.ProxyData, error) {
+    req, err := http.NewRequestWithContext(ctx, "GET", c.url, nil)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create request: %v", err)
+    }
+
+    resp, err := c.httpClient.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch proxies: %v", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        body, _ := io.ReadAll(resp.Body)
+        return nil, fmt.Errorf("list returned status code: %d, body: %s", resp.StatusCode, string(body))
+    }
+
+    body, err := io.ReadAll(resp.Body)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read response body: %v", err)
+    }
+
+    // Lists carry no check or creation times, so LastChecked stays zero and
+    // the service stamps CreatedAt when it first stores the proxy
+    var proxies []models.ProxyData
+    scanner := bufio.NewScanner(bytes.NewReader(body))
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+
+        // Tolerate lists that prefix entries with a scheme
+        if i := strings.Index(line, "://"); i != -1 {
+            line = line[i+3:]
+        }
+
+        host, port, err := net.SplitHostPort(line)
+        if err != nil || net.ParseIP(host) == nil {
+            continue
+        }
+
+        proxies = append(proxies, models.ProxyData{
+            ID:        host + ":" + port,
+            IP:        host,
+            Port:      port,
+            Protocols: []string{c.protocol},
+        })
+
+        if limit > 0 && len(proxies) >= limit {
+            break
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, fmt.Errorf("failed to parse proxy list: %v", err)
+    }
+
+    return proxies, nil
+}
@@ -2,57 +2,415 @@ package config
 
 import (
     "fmt"
+    "log/slog"
+    "net"
+    "net/url"
     "os"
     "strconv"
+    "strings"
     "time"
 )
 
+// Validation modes
+const (
+    ValidationModeAll = "all" // Every target must pass
+    ValidationModeAny = "any" // One passing target is enough
+)
+
+// Storage backends
+const (
+    StorageDynamoDB = "dynamodb"
+    StorageMemory   = "memory"
+)
+
 type Config struct {
+    ConfigFile          string // Empty when no config file was given
+    ConfigWatchInterval time.Duration
+    ShutdownTimeout     time.Duration
+
+    LogLevel           slog.Level
+    StorageBackend     string
     AWSAccessKeyID     string
     AWSSecretAccessKey string
+    AWSSessionToken    string
+    AWSProfile         string
     AWSRegion          string
     DynamoDBTableName  string
     ProxyLimit         int
     UpdateInterval     time.Duration
+    UpdateJitter       time.Duration
+    UpdateMaxBackoff   time.Duration
+    FetchRetries       int
+    FetchRetryDelay    time.Duration
+    FetchTimeout       time.Duration
+    GeoNodeEnabled     bool
+    GeoNodeURL         string
+    GeoNodePageDelay   time.Duration
+    ProxyLists         []ProxyList
+    ValidationTargets  []ValidationTarget
+    ValidationMode     string
+    ValidationTimeout  time.Duration
+    JudgeListenAddr    string
+    JudgeURL           string
+    JudgeOriginIPs     []string
+    APIAddr            string
+    ProxyTTL           time.Duration
+    PurgeInterval      time.Duration
+    LeaseMaxDuration   time.Duration
+    HealthHalfLife     time.Duration
+
+    ValidationConcurrency int
+    RevalidateInterval    time.Duration
+    RevalidateAfter       time.Duration
+    RevalidateConcurrency int
+    RevalidatePageSize    int
+    PoolMetricsInterval   time.Duration
+
+    AWSAssumeRoleARN         string // Assumed on top of the base credentials when set
+    AWSAssumeRoleSessionName string
+    AWSAssumeRoleExternalID  string
+    AWSAssumeRoleDuration    time.Duration
+
+    DynamoDBEndpoint           string // Replaces the AWS endpoint when set
+    DynamoDBCAFile             string
+    DynamoDBInsecureSkipVerify bool
+
+    GatewaySOCKSAddr       string
+    GatewayHTTPAddr        string
+    GatewayStrategy        string
+    GatewayMaxAttempts     int
+    GatewayDialTimeout     time.Duration
+    GatewayRefreshInterval time.Duration
+    GatewaySessionTTL      time.Duration
+
+    effective []resolved // Every setting as resolved, for WriteEffective
 }
 
-func Load() (*Config, error) {
-    cfg := &Config{
-        UpdateInterval: time.Minute, // Default 1 minute
+// ValidationTarget is a URL requested through each proxy during validation
+type ValidationTarget struct {
+    URL            string
+    ExpectedStatus []int  // Status codes counted as success
+    ExpectedBody   string // Substring the response body must contain, if set
+}
+
+// ExpectsStatus reports whether the status code counts as success
+func (t ValidationTarget) ExpectsStatus(code int) bool {
+    for _, expected := range t.ExpectedStatus {
+        if code == expected {
+            return true
+        }
     }
+    return false
+}
 
-    // AWS Configuration
-    cfg.AWSAccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
-    if cfg.AWSAccessKeyID == "" {
-        return nil, fmt.Errorf("AWS_ACCESS_KEY_ID is required")
+// ProxyList is a plain-text ip:port list whose entries all speak Protocol
+type ProxyList struct {
+    Name     string
+    URL      string
+    Protocol string
+}
+
+// Load resolves the configuration from, in increasing precedence, the
+// defaults, the config file given by -config or CONFIG_FILE, environment
+// variables and the command-line flags in args. Every invalid value is
+// reported in the returned error, not just the first.
+func Load(args []string) (*Config, error) {
+    l, err := newLoader(args)
+    if err != nil {
+        return nil, err
     }
+    return build(l)
+}
 
-    cfg.AWSSecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
-    if cfg.AWSSecretAccessKey == "" {
-        return nil, fmt.Errorf("AWS_SECRET_ACCESS_KEY is required")
+// Apply returns the config to switch to on a reload that loaded next while c
+// is in effect. Live settings take next's values and the rest keep c's.
+// applied lists the live settings that changed and rejected the restart-only
+// settings whose change was ignored.
+func (c *Config) Apply(next *Config) (merged *Config, applied, rejected []string, err error) {
+    l := &loader{
+        file:   next.ConfigFile,
+        values: make(map[string]resolved, len(next.effective)),
     }
+    for i, v := range next.effective {
+        if current := c.effective[i]; v.Value != current.Value {
+            if v.Live {
+                applied = append(applied, v.Name)
+            } else {
+                rejected = append(rejected, v.Name)
+                v = current
+            }
+        }
+        l.values[v.Name] = v
+    }
+
+    merged, err = build(l)
+    return merged, applied, rejected, err
+}
 
-    cfg.AWSRegion = os.Getenv("AWS_REGION")
-    if cfg.AWSRegion == "" {
-        cfg.AWSRegion = "eu-west-1" // Europe (Ireland) default region
+// build parses and checks every setting the loader resolved
+func build(l *loader) (*Config, error) {
+    cfg := &Config{
+        ConfigFile:          l.file,
+        ConfigWatchInterval: l.duration("CONFIG_WATCH_INTERVAL", 0),
+        ShutdownTimeout:     l.duration("SHUTDOWN_TIMEOUT", 0),
     }
 
-    cfg.DynamoDBTableName = os.Getenv("DYNAMODB_TABLE_NAME")
-    if cfg.DynamoDBTableName == "" {
-        return nil, fmt.Errorf("DYNAMODB_TABLE_NAME is required")
+    if err := cfg.LogLevel.UnmarshalText([]byte(l.get("LOG_LEVEL"))); err != nil {
+        l.fail("LOG_LEVEL", "expected debug, info, warn or error")
     }
 
-    // Proxy Limit
-    limitStr := os.Getenv("PROXY_LIMIT")
-    if limitStr == "" {
-        cfg.ProxyLimit = 500 // Default limit
+    cfg.StorageBackend = strings.ToLower(l.get("STORAGE_BACKEND"))
+    switch cfg.StorageBackend {
+    case StorageDynamoDB, StorageMemory:
+    default:
+        l.fail("STORAGE_BACKEND", "expected %s or %s", StorageDynamoDB, StorageMemory)
+    }
+
+    // AWS Configuration
+    cfg.AWSRegion = l.get("AWS_REGION")
+    if cfg.StorageBackend == StorageDynamoDB {
+        cfg.DynamoDBTableName = l.require("DYNAMODB_TABLE_NAME")
+    }
+    loadAWSCredentials(cfg, l)
+    loadDynamoDBEndpoint(cfg, l)
+
+    // Scheduling and fetching
+    cfg.ProxyLimit = l.integer("PROXY_LIMIT", 0)
+    cfg.UpdateInterval = l.duration("UPDATE_INTERVAL", time.Second)
+    cfg.UpdateJitter = l.duration("UPDATE_JITTER", 0)
+    if l.isSet("UPDATE_MAX_BACKOFF") {
+        cfg.UpdateMaxBackoff = l.duration("UPDATE_MAX_BACKOFF", cfg.UpdateInterval)
     } else {
-        limit, err := strconv.Atoi(limitStr)
-        if err != nil {
-            return nil, fmt.Errorf("invalid PROXY_LIMIT: %v", err)
+        // The default backoff grows with longer intervals
+        cfg.UpdateMaxBackoff = l.duration("UPDATE_MAX_BACKOFF", 0)
+        if cfg.UpdateMaxBackoff < cfg.UpdateInterval {
+            cfg.UpdateMaxBackoff = cfg.UpdateInterval
+            l.adjust("UPDATE_MAX_BACKOFF", cfg.UpdateInterval.String())
         }
-        cfg.ProxyLimit = limit
     }
+    cfg.FetchRetries = l.integer("FETCH_RETRIES", 1)
+    cfg.FetchRetryDelay = l.duration("FETCH_RETRY_DELAY", 0)
+    cfg.FetchTimeout = l.duration("FETCH_TIMEOUT", time.Second)
+
+    // Expiry
+    cfg.ProxyTTL = l.duration("PROXY_TTL", 0)
+    cfg.PurgeInterval = l.duration("PURGE_INTERVAL", 0)
+
+    // Health scoring
+    cfg.HealthHalfLife = l.duration("HEALTH_HALF_LIFE", time.Minute)
+
+    // Pool size gauges
+    cfg.PoolMetricsInterval = l.duration("POOL_METRICS_INTERVAL", 0)
+
+    // Revalidation of stored proxies
+    cfg.RevalidateInterval = l.duration("REVALIDATE_INTERVAL", 0)
+    cfg.RevalidateAfter = l.duration("REVALIDATE_AFTER", time.Minute)
+    cfg.RevalidateConcurrency = l.integer("REVALIDATE_CONCURRENCY", 1)
+    cfg.RevalidatePageSize = l.integer("REVALIDATE_PAGE_SIZE", 1)
+
+    // Leasing
+    cfg.LeaseMaxDuration = l.duration("LEASE_MAX_DURATION", time.Second)
+
+    // Proxy sources
+    cfg.GeoNodeEnabled = l.boolean("GEONODE_ENABLED")
+    cfg.GeoNodeURL = l.get("GEONODE_URL")
+    if !isHTTPURL(cfg.GeoNodeURL) {
+        l.fail("GEONODE_URL", "not an http(s) url")
+    }
+    cfg.GeoNodePageDelay = l.duration("GEONODE_PAGE_DELAY", 0)
+
+    lists, err := parseProxyLists(l.get("PROXY_LISTS"))
+    if err != nil {
+        l.fail("PROXY_LISTS", "%v", err)
+    }
+    cfg.ProxyLists = lists
+
+    if !cfg.GeoNodeEnabled && len(cfg.ProxyLists) == 0 && l.get("PROXY_LISTS") == "" {
+        l.fail("GEONODE_ENABLED", "at least one proxy source is required, set PROXY_LISTS or enable GeoNode")
+    }
+
+    // Read API, empty disables it
+    cfg.APIAddr = l.get("API_ADDR")
+
+    // Validation
+    loadValidation(cfg, l)
+
+    // Rotating gateway
+    loadGateway(cfg, l)
 
+    if err := l.err(); err != nil {
+        return nil, err
+    }
+    cfg.effective = l.effective()
     return cfg, nil
+}
+
+// loadAWSCredentials reads the optional static keys and role to assume.
+// Without static keys the SDK's default credential chain is used.
+func loadAWSCredentials(cfg *Config, l *loader) {
+    cfg.AWSAccessKeyID = l.get("AWS_ACCESS_KEY_ID")
+    cfg.AWSSecretAccessKey = l.get("AWS_SECRET_ACCESS_KEY")
+    cfg.AWSSessionToken = l.get("AWS_SESSION_TOKEN")
+    cfg.AWSProfile = l.get("AWS_PROFILE")
+
+    if (cfg.AWSAccessKeyID == "") != (cfg.AWSSecretAccessKey == "") {
+        if cfg.AWSAccessKeyID == "" {
+            l.fail("AWS_SECRET_ACCESS_KEY", "AWS_ACCESS_KEY_ID must be set as well")
+        } else {
+            l.fail("AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY must be set as well")
+        }
+    }
+    if cfg.AWSSessionToken != "" && cfg.AWSAccessKeyID == "" {
+        l.fail("AWS_SESSION_TOKEN", "only used with AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+    }
+
+    cfg.AWSAssumeRoleARN = l.get("AWS_ASSUME_ROLE_ARN")
+    if cfg.AWSAssumeRoleARN != "" && (!strings.HasPrefix(cfg.AWSAssumeRoleARN, "arn:") || !strings.Contains(cfg.AWSAssumeRoleARN, ":role/")) {
+        l.fail("AWS_ASSUME_ROLE_ARN", "not an IAM role ARN")
+    }
+    cfg.AWSAssumeRoleSessionName = l.get("AWS_ASSUME_ROLE_SESSION_NAME")
+    cfg.AWSAssumeRoleExternalID = l.get("AWS_ASSUME_ROLE_EXTERNAL_ID")
+    cfg.AWSAssumeRoleDuration = l.duration("AWS_ASSUME_ROLE_DURATION", 15*time.Minute)
+}
+
+// loadDynamoDBEndpoint reads the endpoint override and its TLS settings,
+// which only apply to an https endpoint
+func loadDynamoDBEndpoint(cfg *Config, l *loader) {
+    cfg.DynamoDBEndpoint = l.get("DYNAMODB_ENDPOINT")
+    cfg.DynamoDBCAFile = l.get("DYNAMODB_CA_FILE")
+    cfg.DynamoDBInsecureSkipVerify = l.boolean("DYNAMODB_INSECURE_SKIP_VERIFY")
+
+    https := false
+    if cfg.DynamoDBEndpoint != "" {
+        if !isHTTPURL(cfg.DynamoDBEndpoint) {
+            l.fail("DYNAMODB_ENDPOINT", "not an http(s) url")
+        }
+        https = strings.HasPrefix(strings.ToLower(cfg.DynamoDBEndpoint), "https:")
+    }
+
+    if cfg.DynamoDBCAFile != "" {
+        if !https {
+            l.fail("DYNAMODB_CA_FILE", "only used with an https DYNAMODB_ENDPOINT")
+        } else if _, err := os.Stat(cfg.DynamoDBCAFile); err != nil {
+            l.fail("DYNAMODB_CA_FILE", "%v", err)
+        }
+    }
+    if cfg.DynamoDBInsecureSkipVerify && !https {
+        l.fail("DYNAMODB_INSECURE_SKIP_VERIFY", "only used with an https DYNAMODB_ENDPOINT")
+    }
+}
+
+func loadValidation(cfg *Config, l *loader) {
+    urls := l.list("VALIDATION_URLS")
+    for _, rawURL := range urls {
+        if !isHTTPURL(rawURL) {
+            l.fail("VALIDATION_URLS", "%q is not an http(s) url", rawURL)
+        }
+    }
+    if len(urls) == 0 {
+        l.fail("VALIDATION_URLS", "no urls given")
+    }
+
+    var expectedStatus []int
+    for _, code := range l.list("VALIDATION_EXPECTED_STATUS") {
+        status, err := strconv.Atoi(code)
+        if err != nil || status < 100 || status > 599 {
+            l.fail("VALIDATION_EXPECTED_STATUS", "%q is not a status code", code)
+            continue
+        }
+        expectedStatus = append(expectedStatus, status)
+    }
+    if len(l.list("VALIDATION_EXPECTED_STATUS")) == 0 {
+        l.fail("VALIDATION_EXPECTED_STATUS", "no status codes given")
+    }
+
+    expectedBody := l.get("VALIDATION_EXPECTED_BODY")
+    for _, u := range urls {
+        cfg.ValidationTargets = append(cfg.ValidationTargets, ValidationTarget{
+            URL:            u,
+            ExpectedStatus: expectedStatus,
+            ExpectedBody:   expectedBody,
+        })
+    }
+
+    switch mode := strings.ToLower(l.get("VALIDATION_MODE")); mode {
+    case ValidationModeAll, ValidationModeAny:
+        cfg.ValidationMode = mode
+    default:
+        l.fail("VALIDATION_MODE", "expected all or any")
+    }
+
+    cfg.ValidationTimeout = l.duration("VALIDATION_TIMEOUT", time.Millisecond)
+    cfg.ValidationConcurrency = l.integer("VALIDATION_CONCURRENCY", 1)
+
+    // Anonymity judge
+    cfg.JudgeListenAddr = l.get("JUDGE_LISTEN_ADDR")
+    cfg.JudgeURL = l.get("JUDGE_URL")
+    if cfg.JudgeURL != "" && !isHTTPURL(cfg.JudgeURL) {
+        l.fail("JUDGE_URL", "not an http(s) url")
+    }
+    for _, ip := range l.list("JUDGE_ORIGIN_IPS") {
+        if net.ParseIP(ip) == nil {
+            l.fail("JUDGE_ORIGIN_IPS", "%q is not an IP address", ip)
+            continue
+        }
+        cfg.JudgeOriginIPs = append(cfg.JudgeOriginIPs, ip)
+    }
+}
+
+func loadGateway(cfg *Config, l *loader) {
+    cfg.GatewaySOCKSAddr = l.get("GATEWAY_SOCKS_ADDR")
+    cfg.GatewayHTTPAddr = l.get("GATEWAY_HTTP_ADDR")
+
+    switch strategy := l.get("GATEWAY_STRATEGY"); strategy {
+    case "round-robin", "random", "lowest-latency", "health":
+        cfg.GatewayStrategy = strategy
+    default:
+        l.fail("GATEWAY_STRATEGY", "expected round-robin, random, lowest-latency or health")
+    }
+
+    cfg.GatewayMaxAttempts = l.integer("GATEWAY_MAX_ATTEMPTS", 1)
+    cfg.GatewayDialTimeout = l.duration("GATEWAY_DIAL_TIMEOUT", time.Second)
+    cfg.GatewayRefreshInterval = l.duration("GATEWAY_REFRESH_INTERVAL", time.Second)
+    cfg.GatewaySessionTTL = l.duration("GATEWAY_SESSION_TTL", time.Second)
+}
+
+func isHTTPURL(rawURL string) bool {
+    u, err := url.Parse(rawURL)
+    return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// parseProxyLists parses a comma separated list of protocol=url entries
+func parseProxyLists(value string) ([]ProxyList, error) {
+    var lists []ProxyList
+    for _, entry := range strings.Split(value, ",") {
+        entry = strings.TrimSpace(entry)
+        if entry == "" {
+            continue
+        }
+
+        protocol, rawURL, ok := strings.Cut(entry, "=")
+        if !ok {
+            return nil, fmt.Errorf("entry %q is not in protocol=url form", entry)
+        }
+
+        protocol = strings.ToLower(strings.TrimSpace(protocol))
+        switch protocol {
+        case "http", "https", "socks4", "socks5":
+        default:
+            return nil, fmt.Errorf("entry %q has unsupported protocol %q", entry, protocol)
+        }
+
+        u, err := url.Parse(strings.TrimSpace(rawURL))
+        if err != nil || u.Host == "" {
+            return nil, fmt.Errorf("entry %q has invalid url", entry)
+        }
+
+        lists = append(lists, ProxyList{
+            Name:     u.Host,
+            URL:      u.String(),
+            Protocol: protocol,
+        })
+    }
+    return lists, nil
 }
\ No newline at end of file
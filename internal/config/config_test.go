@@ -0,0 +1,367 @@
+package config
+
+import (
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+)
+
+// writeFile writes a config file with the given name into a temporary
+// directory and returns its path
+func writeFile(t *testing.T, name, content string) string {
+    t.Helper()
+
+    path := filepath.Join(t.TempDir(), name)
+    if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+// sourceOf returns where a loaded setting's value came from
+func sourceOf(cfg *Config, name string) string {
+    for _, v := range cfg.effective {
+        if v.Name == name {
+            return v.Source
+        }
+    }
+    return ""
+}
+
+func TestLoadPrecedence(t *testing.T) {
+    tests := []struct {
+        name       string
+        file       string
+        env        string
+        flag       string
+        want       time.Duration
+        wantSource string
+    }{
+        {"default", "", "", "", time.Minute, sourceDefault},
+        {"file over default", "2m", "", "", 2 * time.Minute, sourceFile},
+        {"env over file", "2m", "3m", "", 3 * time.Minute, sourceEnv},
+        {"flag over env", "2m", "3m", "4m", 4 * time.Minute, sourceFlag},
+        {"flag over default", "", "", "4m", 4 * time.Minute, sourceFlag},
+        {"empty env is ignored", "2m", " ", "", 2 * time.Minute, sourceFile},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            args := []string{"-storage-backend", StorageMemory}
+            if tt.file != "" {
+                args = append(args, "-config", writeFile(t, "config.yaml", "update_interval: "+tt.file+"\n"))
+            }
+            if tt.env != "" {
+                t.Setenv("UPDATE_INTERVAL", tt.env)
+            }
+            if tt.flag != "" {
+                args = append(args, "-update-interval", tt.flag)
+            }
+
+            cfg, err := Load(args)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if cfg.UpdateInterval != tt.want {
+                t.Errorf("UpdateInterval = %v, want %v", cfg.UpdateInterval, tt.want)
+            }
+            if got := sourceOf(cfg, "UPDATE_INTERVAL"); got != tt.wantSource {
+                t.Errorf("source = %s, want %s", got, tt.wantSource)
+            }
+        })
+    }
+}
+
+func TestReadFile(t *testing.T) {
+    tests := []struct {
+        name    string
+        file    string
+        content string
+        want    map[string]string
+        wantErr string
+    }{
+        {
+            name: "yaml",
+            file: "config.yaml",
+            content: `storage_backend: memory
+proxy_limit: 10
+geonode_enabled: false
+validation_urls:
+  - http://a.test
+  - http://b.test
+api_addr:
+`,
+            want: map[string]string{
+                "storage_backend": "memory",
+                "proxy_limit":     "10",
+                "geonode_enabled": "false",
+                "validation_urls": "http://a.test,http://b.test",
+                "api_addr":        "",
+            },
+        },
+        {
+            name: "toml",
+            file: "config.toml",
+            content: `storage_backend = "memory"
+proxy_limit = 10
+geonode_enabled = false
+validation_urls = ["http://a.test", "http://b.test"]
+`,
+            want: map[string]string{
+                "storage_backend": "memory",
+                "proxy_limit":     "10",
+                "geonode_enabled": "false",
+                "validation_urls": "http://a.test,http://b.test",
+            },
+        },
+        {
+            name:    "yml extension",
+            file:    "config.yml",
+            content: "log_level: debug\n",
+            want:    map[string]string{"log_level": "debug"},
+        },
+        {
+            name:    "unsupported extension",
+            file:    "config.json",
+            content: `{"log_level": "debug"}`,
+            wantErr: "unsupported config file",
+        },
+        {
+            name:    "nested value",
+            file:    "config.yaml",
+            content: "gateway:\n  strategy: random\n",
+            wantErr: "invalid gateway in config file",
+        },
+        {
+            name:    "malformed toml",
+            file:    "config.toml",
+            content: "log_level = \n",
+            wantErr: "failed to parse config file",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := readFile(writeFile(t, tt.file, tt.content))
+            if tt.wantErr != "" {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("readFile error = %v, want one containing %q", err, tt.wantErr)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("readFile = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestLoadFileUnknownSetting(t *testing.T) {
+    path := writeFile(t, "config.yaml", "storage_backend: memory\nupdate_intervall: 2m\n")
+    _, err := Load([]string{"-config", path})
+    if err == nil || !strings.Contains(err.Error(), "unknown setting update_intervall in file") {
+        t.Errorf("Load error = %v, want the misspelled key reported", err)
+    }
+}
+
+func TestLoadReportsEveryError(t *testing.T) {
+    tests := []struct {
+        name string
+        args []string
+        want []string
+    }{
+        {
+            name: "every invalid value",
+            args: []string{"-update-interval", "soon", "-fetch-retries", "0", "-log-level", "loud"},
+            want: []string{
+                `invalid UPDATE_INTERVAL "soon" from flag: not a duration`,
+                `invalid FETCH_RETRIES "0" from flag: must be at least 1`,
+                `invalid LOG_LEVEL "loud" from flag`,
+            },
+        },
+        {
+            name: "max backoff below interval",
+            args: []string{"-update-interval", "10m", "-update-max-backoff", "1m"},
+            want: []string{`invalid UPDATE_MAX_BACKOFF "1m" from flag: must be at least 10m0s`},
+        },
+        {
+            name: "missing table and unpaired key",
+            args: []string{"-storage-backend", StorageDynamoDB, "-aws-access-key-id", "AKIDEXAMPLE"},
+            want: []string{
+                "DYNAMODB_TABLE_NAME is required",
+                "AWS_SECRET_ACCESS_KEY must be set as well",
+            },
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            args := append([]string{"-storage-backend", StorageMemory}, tt.args...)
+            _, err := Load(args)
+            if err == nil {
+                t.Fatal("Load succeeded, want an error")
+            }
+            for _, want := range tt.want {
+                if !strings.Contains(err.Error(), want) {
+                    t.Errorf("error does not report %q:\n%v", want, err)
+                }
+            }
+        })
+    }
+}
+
+func TestSecretsAreRedacted(t *testing.T) {
+    const (
+        keyID  = "AKIDEXAMPLE"
+        secret = "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY"
+        token  = "FwoGZXIvYXdzEXAMPLETOKEN"
+    )
+
+    t.Run("effective config", func(t *testing.T) {
+        t.Setenv("AWS_SECRET_ACCESS_KEY", secret)
+        cfg, err := Load([]string{
+            "-storage-backend", StorageMemory,
+            "-aws-access-key-id", keyID,
+            "-aws-session-token", token,
+        })
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        var b strings.Builder
+        if err := cfg.WriteEffective(&b); err != nil {
+            t.Fatal(err)
+        }
+        out := b.String()
+
+        for _, value := range []string{keyID, secret, token} {
+            if strings.Contains(out, value) {
+                t.Errorf("effective config contains the secret %q", value)
+            }
+        }
+        for _, line := range []string{
+            `aws_access_key_id: "[REDACTED]"  # flag`,
+            `aws_secret_access_key: "[REDACTED]"  # env`,
+            `aws_session_token: "[REDACTED]"  # flag`,
+            `storage_backend: "memory"  # flag`,
+            `aws_region: "eu-west-1"  # default`,
+        } {
+            if !strings.Contains(out, line+"\n") {
+                t.Errorf("effective config is missing %s:\n%s", line, out)
+            }
+        }
+    })
+
+    t.Run("unset secrets stay empty", func(t *testing.T) {
+        cfg, err := Load([]string{"-storage-backend", StorageMemory})
+        if err != nil {
+            t.Fatal(err)
+        }
+        var b strings.Builder
+        if err := cfg.WriteEffective(&b); err != nil {
+            t.Fatal(err)
+        }
+        if !strings.Contains(b.String(), `aws_secret_access_key: ""  # default`) {
+            t.Errorf("unset secret is not printed empty:\n%s", b.String())
+        }
+    })
+
+    t.Run("validation errors", func(t *testing.T) {
+        _, err := Load([]string{"-storage-backend", StorageMemory, "-aws-session-token", token})
+        if err == nil {
+            t.Fatal("Load with a session token and no keys succeeded, want an error")
+        }
+        if strings.Contains(err.Error(), token) {
+            t.Errorf("error contains the secret: %v", err)
+        }
+        if !strings.Contains(err.Error(), `invalid AWS_SESSION_TOKEN "[REDACTED]"`) {
+            t.Errorf("error = %v, want the redacted token reported", err)
+        }
+    })
+}
+
+func TestApply(t *testing.T) {
+    load := func(t *testing.T, args ...string) *Config {
+        t.Helper()
+        cfg, err := Load(append([]string{"-storage-backend", StorageMemory}, args...))
+        if err != nil {
+            t.Fatal(err)
+        }
+        return cfg
+    }
+
+    tests := []struct {
+        name         string
+        next         []string
+        wantApplied  []string
+        wantRejected []string
+        check        func(t *testing.T, merged *Config)
+    }{
+        {
+            name: "unchanged",
+        },
+        {
+            name:        "live settings",
+            next:        []string{"-log-level", "debug", "-update-interval", "20m"},
+            wantApplied: []string{"LOG_LEVEL", "UPDATE_INTERVAL", "UPDATE_MAX_BACKOFF"},
+            check: func(t *testing.T, merged *Config) {
+                if merged.LogLevel.String() != "DEBUG" || merged.UpdateInterval != 20*time.Minute {
+                    t.Errorf("merged LogLevel = %v, UpdateInterval = %v, want DEBUG and 20m", merged.LogLevel, merged.UpdateInterval)
+                }
+                // The defaulted backoff grows with the new interval
+                if merged.UpdateMaxBackoff != 20*time.Minute {
+                    t.Errorf("merged UpdateMaxBackoff = %v, want 20m", merged.UpdateMaxBackoff)
+                }
+            },
+        },
+        {
+            name:         "restart-only settings",
+            next:         []string{"-lease-max-duration", "1h", "-api-addr", ""},
+            wantRejected: []string{"LEASE_MAX_DURATION", "API_ADDR"},
+            check: func(t *testing.T, merged *Config) {
+                if merged.LeaseMaxDuration != 10*time.Minute || merged.APIAddr != "127.0.0.1:8080" {
+                    t.Errorf("merged LeaseMaxDuration = %v, APIAddr = %q, want the current 10m and 127.0.0.1:8080", merged.LeaseMaxDuration, merged.APIAddr)
+                }
+                if got := sourceOf(merged, "LEASE_MAX_DURATION"); got != sourceDefault {
+                    t.Errorf("merged LEASE_MAX_DURATION source = %s, want the current default", got)
+                }
+            },
+        },
+        {
+            name:         "mixed",
+            next:         []string{"-fetch-retries", "5", "-gateway-strategy", "random"},
+            wantApplied:  []string{"FETCH_RETRIES"},
+            wantRejected: []string{"GATEWAY_STRATEGY"},
+            check: func(t *testing.T, merged *Config) {
+                if merged.FetchRetries != 5 || merged.GatewayStrategy != "round-robin" {
+                    t.Errorf("merged FetchRetries = %d, GatewayStrategy = %q, want 5 and round-robin", merged.FetchRetries, merged.GatewayStrategy)
+                }
+            },
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            current := load(t)
+            merged, applied, rejected, err := current.Apply(load(t, tt.next...))
+            if err != nil {
+                t.Fatal(err)
+            }
+            if strings.Join(applied, ",") != strings.Join(tt.wantApplied, ",") {
+                t.Errorf("applied = %v, want %v", applied, tt.wantApplied)
+            }
+            if strings.Join(rejected, ",") != strings.Join(tt.wantRejected, ",") {
+                t.Errorf("rejected = %v, want %v", rejected, tt.wantRejected)
+            }
+            if tt.check != nil {
+                tt.check(t, merged)
+            }
+        })
+    }
+}
@@ -0,0 +1,84 @@
+package config
+
+// setting is one configurable value. Its name is the environment variable;
+// config file keys are the lowercase name and flags the lowercase name with
+// dashes, so UPDATE_INTERVAL is update_interval in a file and -update-interval
+// on the command line.
+type setting struct {
+    Name       string
+    Default    string
+    Usage      string
+    Secret     bool // Redacted when the effective config is printed
+    AllowEmpty bool // An explicit empty value overrides the default instead of being ignored
+    Live       bool // Applied by a reload without restarting
+}
+
+// settings lists everything Load reads, in the order the effective config is
+// printed. Settings that are not Live are only read on startup: they set up
+// storage, listeners or other state a reload cannot swap out.
+var settings = []setting{
+    {Name: "CONFIG_WATCH_INTERVAL", Default: "10s", Usage: "how often the config file is checked for changes, 0 to only reload on SIGHUP"},
+    {Name: "LOG_LEVEL", Default: "info", Usage: "debug, info, warn or error", Live: true},
+    {Name: "STORAGE_BACKEND", Default: StorageDynamoDB, Usage: "dynamodb or memory"},
+    {Name: "SHUTDOWN_TIMEOUT", Default: "30s", Usage: "how long shutdown waits for in-flight validation and writes before abandoning them"},
+
+    {Name: "AWS_ACCESS_KEY_ID", Usage: "static AWS access key ID, the default credential chain is used when empty", Secret: true},
+    {Name: "AWS_SECRET_ACCESS_KEY", Usage: "static AWS secret access key", Secret: true},
+    {Name: "AWS_SESSION_TOKEN", Usage: "session token for temporary static credentials", Secret: true},
+    {Name: "AWS_PROFILE", Usage: "shared config profile used by the default credential chain"},
+    {Name: "AWS_ASSUME_ROLE_ARN", Usage: "IAM role assumed with the base credentials"},
+    {Name: "AWS_ASSUME_ROLE_SESSION_NAME", Default: "proxy-system", Usage: "session name for the assumed role"},
+    {Name: "AWS_ASSUME_ROLE_EXTERNAL_ID", Usage: "external ID required by the assumed role's trust policy"},
+    {Name: "AWS_ASSUME_ROLE_DURATION", Default: "1h", Usage: "how long each set of assumed role credentials lasts"},
+    {Name: "AWS_REGION", Default: "eu-west-1", Usage: "AWS region"},
+    {Name: "DYNAMODB_TABLE_NAME", Usage: "DynamoDB table for storing proxies"},
+    {Name: "DYNAMODB_ENDPOINT", Usage: "DynamoDB endpoint URL replacing the AWS one, e.g. http://localhost:8000 for DynamoDB Local"},
+    {Name: "DYNAMODB_CA_FILE", Usage: "PEM file of CA certificates trusted for an https endpoint"},
+    {Name: "DYNAMODB_INSECURE_SKIP_VERIFY", Default: "false", Usage: "skip certificate verification for an https endpoint"},
+
+    {Name: "PROXY_LIMIT", Default: "500", Usage: "maximum proxies fetched per source, 0 for every page", Live: true},
+    {Name: "UPDATE_INTERVAL", Default: "1m", Usage: "time between update cycles", Live: true},
+    {Name: "UPDATE_JITTER", Default: "5s", Usage: "random jitter added to or removed from each interval", Live: true},
+    {Name: "UPDATE_MAX_BACKOFF", Default: "15m", Usage: "longest wait between cycles while they keep failing", Live: true},
+    {Name: "FETCH_RETRIES", Default: "3", Usage: "attempts per source and cycle", Live: true},
+    {Name: "FETCH_RETRY_DELAY", Default: "3s", Usage: "delay between attempts against a source", Live: true},
+    {Name: "FETCH_TIMEOUT", Default: "15s", Usage: "timeout for each request to a proxy source", Live: true},
+
+    {Name: "PROXY_TTL", Default: "24h", Usage: "how long a proxy is kept after its last check or successful validation, 0 to keep forever"},
+    {Name: "PURGE_INTERVAL", Default: "0s", Usage: "how often to delete expired proxies explicitly, 0 to disable", Live: true},
+    {Name: "HEALTH_HALF_LIFE", Default: "6h", Usage: "half-life of the validation history behind the health score", Live: true},
+    {Name: "POOL_METRICS_INTERVAL", Default: "5m", Usage: "how often the pool size gauges are recounted from storage, 0 to disable", Live: true},
+
+    {Name: "REVALIDATE_INTERVAL", Default: "10m", Usage: "how often stored proxies are rechecked, 0 to disable", Live: true},
+    {Name: "REVALIDATE_AFTER", Default: "30m", Usage: "how old a proxy's own validation must be before it is rechecked", Live: true},
+    {Name: "REVALIDATE_CONCURRENCY", Default: "50", Usage: "concurrent validations used by the recheck", Live: true},
+    {Name: "REVALIDATE_PAGE_SIZE", Default: "100", Usage: "stored proxies read per page during the recheck", Live: true},
+
+    {Name: "LEASE_MAX_DURATION", Default: "10m", Usage: "longest a proxy lease may be held"},
+
+    {Name: "GEONODE_ENABLED", Default: "true", Usage: "fetch proxies from GeoNode", Live: true},
+    {Name: "GEONODE_URL", Default: "https://proxylist.geonode.com/api/proxy-list", Usage: "GeoNode proxy list API", Live: true},
+    {Name: "GEONODE_PAGE_DELAY", Default: "1s", Usage: "delay between GeoNode page requests", Live: true},
+    {Name: "PROXY_LISTS", Usage: "comma separated protocol=url plain-text proxy lists", Live: true},
+
+    {Name: "API_ADDR", Default: "127.0.0.1:8080", Usage: "address for the HTTP API, empty disables it", AllowEmpty: true},
+
+    {Name: "VALIDATION_URLS", Default: "http://httpbin.org/ip", Usage: "comma separated URLs requested through each proxy", Live: true},
+    {Name: "VALIDATION_EXPECTED_STATUS", Default: "200", Usage: "comma separated status codes counted as success", Live: true},
+    {Name: "VALIDATION_EXPECTED_BODY", Usage: "substring every validation response must contain", Live: true},
+    {Name: "VALIDATION_MODE", Default: ValidationModeAll, Usage: "all if every URL must pass, any if one is enough", Live: true},
+    {Name: "VALIDATION_TIMEOUT", Default: "10s", Usage: "timeout for each validation request", Live: true},
+    {Name: "VALIDATION_CONCURRENCY", Default: "500", Usage: "concurrent validations in an update cycle", Live: true},
+
+    {Name: "JUDGE_LISTEN_ADDR", Usage: "address to run the embedded anonymity judge on"},
+    {Name: "JUDGE_URL", Usage: "URL of the judge as reachable by the proxies"},
+    {Name: "JUDGE_ORIGIN_IPS", Usage: "comma separated public IPs of this host"},
+
+    {Name: "GATEWAY_SOCKS_ADDR", Usage: "address for the gateway's SOCKS5 listener"},
+    {Name: "GATEWAY_HTTP_ADDR", Usage: "address for the gateway's HTTP CONNECT listener"},
+    {Name: "GATEWAY_STRATEGY", Default: "round-robin", Usage: "round-robin, random, lowest-latency or health"},
+    {Name: "GATEWAY_MAX_ATTEMPTS", Default: "3", Usage: "upstream proxies tried per connection"},
+    {Name: "GATEWAY_DIAL_TIMEOUT", Default: "10s", Usage: "timeout for reaching the target through one upstream"},
+    {Name: "GATEWAY_REFRESH_INTERVAL", Default: "1m", Usage: "how often the gateway reloads its pool"},
+    {Name: "GATEWAY_SESSION_TTL", Default: "10m", Usage: "how long a gateway session stays pinned after its last use"},
+}
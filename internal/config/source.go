@@ -0,0 +1,291 @@
+package config
+
+import (
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/BurntSushi/toml"
+    "gopkg.in/yaml.v3"
+)
+
+// Where a setting's value came from, lowest precedence first
+const (
+    sourceDefault = "default"
+    sourceFile    = "file"
+    sourceEnv     = "env"
+    sourceFlag    = "flag"
+)
+
+// redacted replaces secret values when the effective config is printed
+const redacted = "[REDACTED]"
+
+// resolved is the value a setting ended up with and where it came from
+type resolved struct {
+    setting
+    Value  string
+    Source string
+}
+
+// loader resolves every setting from defaults, the config file, the
+// environment and flags, and collects every invalid value instead of
+// stopping at the first
+type loader struct {
+    file   string
+    values map[string]resolved
+    errs   []error
+}
+
+// flagName turns a setting name into its command-line flag
+func flagName(name string) string {
+    return strings.ToLower(strings.ReplaceAll(name, "_", "-"))
+}
+
+// settingName turns a config file key or flag into a setting name
+func settingName(key string) string {
+    return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(key), "-", "_"))
+}
+
+func newLoader(args []string) (*loader, error) {
+    fs := flag.NewFlagSet("proxy-system", flag.ContinueOnError)
+    file := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML config file (CONFIG_FILE)")
+    for _, s := range settings {
+        fs.String(flagName(s.Name), s.Default, fmt.Sprintf("%s (%s)", s.Usage, s.Name))
+    }
+    if err := fs.Parse(args); err != nil {
+        return nil, err
+    }
+    if fs.NArg() > 0 {
+        return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+    }
+
+    l := &loader{
+        file:   *file,
+        values: make(map[string]resolved, len(settings)),
+    }
+    for _, s := range settings {
+        l.values[s.Name] = resolved{setting: s, Value: s.Default, Source: sourceDefault}
+    }
+
+    if l.file != "" {
+        values, err := readFile(l.file)
+        if err != nil {
+            return nil, err
+        }
+        for key, value := range values {
+            l.set(settingName(key), value, sourceFile)
+        }
+    }
+
+    for _, s := range settings {
+        if value, ok := os.LookupEnv(s.Name); ok {
+            l.set(s.Name, value, sourceEnv)
+        }
+    }
+
+    fs.Visit(func(f *flag.Flag) {
+        if f.Name != "config" {
+            l.set(settingName(f.Name), f.Value.String(), sourceFlag)
+        }
+    })
+
+    return l, nil
+}
+
+// set overrides a setting. Empty values are treated as unset unless the
+// setting allows them.
+func (l *loader) set(name, value, source string) {
+    current, ok := l.values[name]
+    if !ok {
+        l.errs = append(l.errs, fmt.Errorf("unknown setting %s in %s", strings.ToLower(name), source))
+        return
+    }
+    value = strings.TrimSpace(value)
+    if value == "" && !current.AllowEmpty {
+        return
+    }
+    current.Value = value
+    current.Source = source
+    l.values[name] = current
+}
+
+// readFile reads a flat YAML or TOML config file, picked by extension
+func readFile(path string) (map[string]string, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read config file: %v", err)
+    }
+
+    raw := map[string]interface{}{}
+    switch strings.ToLower(filepath.Ext(path)) {
+    case ".yaml", ".yml":
+        err = yaml.Unmarshal(data, &raw)
+    case ".toml":
+        _, err = toml.Decode(string(data), &raw)
+    default:
+        return nil, fmt.Errorf("unsupported config file %s (expected .yaml, .yml or .toml)", path)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+    }
+
+    values := make(map[string]string, len(raw))
+    for key, value := range raw {
+        str, err := fileValue(value)
+        if err != nil {
+            return nil, fmt.Errorf("invalid %s in config file: %v", key, err)
+        }
+        values[key] = str
+    }
+    return values, nil
+}
+
+// fileValue flattens a config file value into the form the environment
+// variable takes. Lists become comma separated.
+func fileValue(value interface{}) (string, error) {
+    switch v := value.(type) {
+    case nil:
+        return "", nil
+    case string:
+        return v, nil
+    case bool, int, int64, uint64, float64:
+        return fmt.Sprint(v), nil
+    case []interface{}:
+        items := make([]string, len(v))
+        for i, item := range v {
+            str, err := fileValue(item)
+            if err != nil {
+                return "", err
+            }
+            items[i] = str
+        }
+        return strings.Join(items, ","), nil
+    default:
+        return "", fmt.Errorf("unsupported value of type %T", value)
+    }
+}
+
+// adjust replaces a defaulted value that was derived from other settings
+func (l *loader) adjust(name, value string) {
+    v := l.values[name]
+    v.Value = value
+    l.values[name] = v
+}
+
+func (l *loader) get(name string) string {
+    return l.values[name].Value
+}
+
+// isSet reports whether the setting was given anywhere rather than defaulted
+func (l *loader) isSet(name string) bool {
+    return l.values[name].Source != sourceDefault
+}
+
+// fail records an invalid value for the setting
+func (l *loader) fail(name, format string, args ...interface{}) {
+    v := l.values[name]
+    value := v.Value
+    if v.Secret {
+        value = redacted
+    }
+    l.errs = append(l.errs, fmt.Errorf("invalid %s %q from %s: %s", name, value, v.Source, fmt.Sprintf(format, args...)))
+}
+
+// require records an error if the setting is empty
+func (l *loader) require(name string) string {
+    value := l.get(name)
+    if value == "" {
+        l.errs = append(l.errs, fmt.Errorf("%s is required", name))
+    }
+    return value
+}
+
+// duration parses a duration setting, rejecting anything below minimum
+func (l *loader) duration(name string, minimum time.Duration) time.Duration {
+    value, err := time.ParseDuration(l.get(name))
+    if err != nil {
+        l.fail(name, "not a duration")
+        return 0
+    }
+    if value < minimum {
+        l.fail(name, "must be at least %v", minimum)
+    }
+    return value
+}
+
+// integer parses an integer setting, rejecting anything below minimum
+func (l *loader) integer(name string, minimum int) int {
+    value, err := strconv.Atoi(l.get(name))
+    if err != nil {
+        l.fail(name, "not an integer")
+        return 0
+    }
+    if value < minimum {
+        l.fail(name, "must be at least %d", minimum)
+    }
+    return value
+}
+
+func (l *loader) boolean(name string) bool {
+    value, err := strconv.ParseBool(l.get(name))
+    if err != nil {
+        l.fail(name, "not a boolean")
+    }
+    return value
+}
+
+// list splits a comma separated setting, dropping empty entries
+func (l *loader) list(name string) []string {
+    var items []string
+    for _, item := range strings.Split(l.get(name), ",") {
+        if item = strings.TrimSpace(item); item != "" {
+            items = append(items, item)
+        }
+    }
+    return items
+}
+
+// err combines every recorded error, or returns nil if there were none
+func (l *loader) err() error {
+    if len(l.errs) == 0 {
+        return nil
+    }
+    messages := make([]string, len(l.errs))
+    for i, err := range l.errs {
+        messages[i] = err.Error()
+    }
+    return fmt.Errorf("invalid configuration:\n  %s", strings.Join(messages, "\n  "))
+}
+
+// effective lists every setting in registry order
+func (l *loader) effective() []resolved {
+    values := make([]resolved, len(settings))
+    for i, s := range settings {
+        values[i] = l.values[s.Name]
+    }
+    return values
+}
+
+// WriteEffective writes the config as a YAML file with the source of every
+// value, so it can be inspected or used as a starting point. Secrets are
+// redacted.
+func (c *Config) WriteEffective(w io.Writer) error {
+    var b strings.Builder
+    if c.ConfigFile != "" {
+        fmt.Fprintf(&b, "# config file: %s\n", c.ConfigFile)
+    }
+    for _, v := range c.effective {
+        value := v.Value
+        if v.Secret && value != "" {
+            value = redacted
+        }
+        fmt.Fprintf(&b, "%s: %s  # %s\n", strings.ToLower(v.Name), strconv.Quote(value), v.Source)
+    }
+    _, err := io.WriteString(w, b.String())
+    return err
+}
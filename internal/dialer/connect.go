@@ -0,0 +1,85 @@
+package dialer
+
+import (
+    "bufio"
+    "context"
+    "fmt"
+    "net"
+    "net/http"
+    "time"
+
+    "golang.org/x/net/proxy"
+)
+
+type httpConnect struct {
+    addr    string
+    forward proxy.Dialer
+}
+
+// HTTPConnect returns a Dialer that opens tunnels through an HTTP proxy at
+// addr using the CONNECT method. If forward is nil the proxy is dialed directly.
+func HTTPConnect(addr string, forward proxy.Dialer) proxy.Dialer {
+    if forward == nil {
+        forward = proxy.Direct
+    }
+    return &httpConnect{
+        addr:    addr,
+        forward: forward,
+    }
+}
+
+func (d *httpConnect) Dial(network, addr string) (net.Conn, error) {
+    return d.DialContext(context.Background(), network, addr)
+}
+
+func (d *httpConnect) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+    if network != "tcp" && network != "tcp4" && network != "tcp6" {
+        return nil, fmt.Errorf("connect: unsupported network %s", network)
+    }
+
+    conn, err := dialForward(ctx, d.forward, "tcp", d.addr)
+    if err != nil {
+        return nil, err
+    }
+
+    if deadline, ok := ctx.Deadline(); ok {
+        conn.SetDeadline(deadline)
+        defer conn.SetDeadline(time.Time{})
+    }
+
+    request := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", addr, addr)
+    if _, err := conn.Write([]byte(request)); err != nil {
+        conn.Close()
+        return nil, fmt.Errorf("connect: failed to write request to %s: %v", d.addr, err)
+    }
+
+    reader := bufio.NewReader(conn)
+    resp, err := http.ReadResponse(reader, &http.Request{Method: "CONNECT"})
+    if err != nil {
+        conn.Close()
+        return nil, fmt.Errorf("connect: failed to read response from %s: %v", d.addr, err)
+    }
+    resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        conn.Close()
+        return nil, fmt.Errorf("connect: proxy %s returned status %d", d.addr, resp.StatusCode)
+    }
+
+    // The proxy may have sent tunnelled bytes along with its response
+    if reader.Buffered() > 0 {
+        return &bufferedConn{Conn: conn, reader: reader}, nil
+    }
+    return conn, nil
+}
+
+// bufferedConn drains bytes read ahead during the handshake before reading
+// from the underlying connection again
+type bufferedConn struct {
+    net.Conn
+    reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+    return c.reader.Read(b)
+}
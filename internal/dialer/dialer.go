@@ -0,0 +1,41 @@
+package dialer
+
+import (
+    "fmt"
+
+    "golang.org/x/net/proxy"
+)
+
+// Dialer is a proxy.Dialer that also honours contexts
+type Dialer interface {
+    proxy.Dialer
+    proxy.ContextDialer
+}
+
+// ForProtocol returns a Dialer that tunnels connections through the proxy at
+// addr using the given protocol. Plain http proxies are not tunnels and have
+// no Dialer; use them as a forward proxy instead.
+func ForProtocol(protocol, addr string) (Dialer, error) {
+    var d proxy.Dialer
+    var err error
+
+    switch protocol {
+    case "socks5":
+        d, err = proxy.SOCKS5("tcp", addr, nil, nil)
+    case "socks4":
+        d, err = SOCKS4("tcp", addr, "", nil)
+    case "https":
+        d = HTTPConnect(addr, nil)
+    default:
+        return nil, fmt.Errorf("no dialer for protocol %s", protocol)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    contextDialer, ok := d.(Dialer)
+    if !ok {
+        return nil, fmt.Errorf("%s dialer does not support contexts", protocol)
+    }
+    return contextDialer, nil
+}
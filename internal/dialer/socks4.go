@@ -0,0 +1,168 @@
+package dialer
+
+import (
+    "context"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "net"
+    "strconv"
+    "time"
+
+    "golang.org/x/net/proxy"
+)
+
+// SOCKS4 wire constants
+const (
+    socks4Version        = 0x04
+    socks4CmdConnect     = 0x01
+    socks4Granted        = 0x5a
+    socks4Rejected       = 0x5b
+    socks4IdentdMissing  = 0x5c
+    socks4IdentdMismatch = 0x5d
+)
+
+type socks4 struct {
+    addr          string
+    userID        string
+    forward       proxy.Dialer
+    remoteResolve bool // Always send hostnames with SOCKS4a
+    lookupIP      func(ctx context.Context, network, host string) ([]net.IP, error)
+}
+
+// SOCKS4 returns a Dialer that makes connections to addr through a SOCKS4
+// proxy. Targets given as hostnames are resolved locally, as plain SOCKS4
+// servers only take IPv4 addresses, and sent using the SOCKS4a extension only
+// when they do not resolve here. If forward is nil the proxy is dialed directly.
+func SOCKS4(network, addr, userID string, forward proxy.Dialer) (proxy.Dialer, error) {
+    return newSOCKS4(network, addr, userID, forward, false)
+}
+
+// SOCKS4A is like SOCKS4 but always leaves hostnames for the proxy to resolve
+func SOCKS4A(network, addr, userID string, forward proxy.Dialer) (proxy.Dialer, error) {
+    return newSOCKS4(network, addr, userID, forward, true)
+}
+
+func newSOCKS4(network, addr, userID string, forward proxy.Dialer, remoteResolve bool) (*socks4, error) {
+    if network != "tcp" && network != "tcp4" {
+        return nil, fmt.Errorf("socks4: unsupported network %s", network)
+    }
+    if forward == nil {
+        forward = proxy.Direct
+    }
+    return &socks4{
+        addr:          addr,
+        userID:        userID,
+        forward:       forward,
+        remoteResolve: remoteResolve,
+        lookupIP:      net.DefaultResolver.LookupIP,
+    }, nil
+}
+
+func (d *socks4) Dial(network, addr string) (net.Conn, error) {
+    return d.DialContext(context.Background(), network, addr)
+}
+
+func (d *socks4) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+    if network != "tcp" && network != "tcp4" {
+        return nil, fmt.Errorf("socks4: unsupported network %s", network)
+    }
+
+    request, err := d.connectRequest(ctx, addr)
+    if err != nil {
+        return nil, err
+    }
+
+    conn, err := dialForward(ctx, d.forward, "tcp", d.addr)
+    if err != nil {
+        return nil, err
+    }
+
+    if deadline, ok := ctx.Deadline(); ok {
+        conn.SetDeadline(deadline)
+        defer conn.SetDeadline(time.Time{})
+    }
+
+    if _, err := conn.Write(request); err != nil {
+        conn.Close()
+        return nil, fmt.Errorf("socks4: failed to write request to %s: %v", d.addr, err)
+    }
+
+    reply := make([]byte, 8)
+    if _, err := io.ReadFull(conn, reply); err != nil {
+        conn.Close()
+        return nil, fmt.Errorf("socks4: failed to read reply from %s: %v", d.addr, err)
+    }
+
+    // The reply version should be 0, but some servers echo the request's 4
+    if reply[0] != 0x00 && reply[0] != socks4Version {
+        conn.Close()
+        return nil, fmt.Errorf("socks4: unexpected reply version %d from %s", reply[0], d.addr)
+    }
+
+    switch reply[1] {
+    case socks4Granted:
+        return conn, nil
+    case socks4Rejected:
+        err = fmt.Errorf("socks4: request rejected or failed")
+    case socks4IdentdMissing:
+        err = fmt.Errorf("socks4: proxy could not reach identd")
+    case socks4IdentdMismatch:
+        err = fmt.Errorf("socks4: identd user id mismatch")
+    default:
+        err = fmt.Errorf("socks4: unknown reply code %d", reply[1])
+    }
+    conn.Close()
+    return nil, err
+}
+
+// connectRequest builds a SOCKS4 CONNECT request, or a SOCKS4a one when the
+// target host is a name that is not resolved locally
+func (d *socks4) connectRequest(ctx context.Context, addr string) ([]byte, error) {
+    host, portStr, err := net.SplitHostPort(addr)
+    if err != nil {
+        return nil, fmt.Errorf("socks4: invalid address %s: %v", addr, err)
+    }
+
+    port, err := strconv.ParseUint(portStr, 10, 16)
+    if err != nil {
+        return nil, fmt.Errorf("socks4: invalid port %s", portStr)
+    }
+
+    request := []byte{socks4Version, socks4CmdConnect, 0, 0}
+    binary.BigEndian.PutUint16(request[2:], uint16(port))
+
+    ip := net.ParseIP(host)
+    if ip != nil && ip.To4() == nil {
+        return nil, fmt.Errorf("socks4: IPv6 target %s is not supported", host)
+    }
+    if ip == nil && !d.remoteResolve {
+        // Fall back to SOCKS4a if the name has no IPv4 address here
+        if ips, err := d.lookupIP(ctx, "ip4", host); err == nil && len(ips) > 0 {
+            ip = ips[0]
+        }
+    }
+
+    if ip != nil {
+        request = append(request, ip.To4()...)
+        request = append(request, d.userID...)
+        request = append(request, 0)
+    } else {
+        // SOCKS4a: an invalid IP of 0.0.0.x tells the proxy a hostname follows
+        request = append(request, 0, 0, 0, 1)
+        request = append(request, d.userID...)
+        request = append(request, 0)
+        request = append(request, host...)
+        request = append(request, 0)
+    }
+
+    return request, nil
+}
+
+// dialForward dials through forward, honouring ctx when the dialer supports it
+func dialForward(ctx context.Context, forward proxy.Dialer, network, addr string) (net.Conn, error) {
+    if contextDialer, ok := forward.(proxy.ContextDialer); ok {
+        return contextDialer.DialContext(ctx, network, addr)
+    }
+    return forward.Dial(network, addr)
+}
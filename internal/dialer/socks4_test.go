@@ -0,0 +1,143 @@
+package dialer
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "io"
+    "net"
+    "strings"
+    "testing"
+)
+
+// pipeDialer hands out the client end of a net.Pipe whose other end is served
+// by a fake SOCKS4 server
+type pipeDialer struct {
+    conn net.Conn
+}
+
+func (d *pipeDialer) Dial(network, addr string) (net.Conn, error) {
+    return d.conn, nil
+}
+
+// fakeSOCKS4 reads one CONNECT request of the expected length, records it
+// and answers with reply
+func fakeSOCKS4(t *testing.T, server net.Conn, length int, reply []byte) <-chan []byte {
+    t.Helper()
+
+    received := make(chan []byte, 1)
+    go func() {
+        defer close(received)
+        request := make([]byte, length)
+        if _, err := io.ReadFull(server, request); err != nil {
+            t.Errorf("fake server failed to read request: %v", err)
+            return
+        }
+        received <- request
+        server.Write(reply)
+    }()
+    return received
+}
+
+func newTestSOCKS4(t *testing.T, remoteResolve bool, lookup map[string]string) (*socks4, net.Conn) {
+    t.Helper()
+
+    client, server := net.Pipe()
+    t.Cleanup(func() {
+        client.Close()
+        server.Close()
+    })
+
+    d, err := newSOCKS4("tcp", "proxy.test:1080", "user", &pipeDialer{conn: client}, remoteResolve)
+    if err != nil {
+        t.Fatal(err)
+    }
+    d.lookupIP = func(ctx context.Context, network, host string) ([]net.IP, error) {
+        if ip, ok := lookup[host]; ok {
+            return []net.IP{net.ParseIP(ip)}, nil
+        }
+        return nil, errors.New("no such host")
+    }
+    return d, server
+}
+
+func TestSOCKS4Request(t *testing.T) {
+    tests := []struct {
+        name          string
+        target        string
+        remoteResolve bool
+        want          []byte
+    }{
+        {
+            name:   "ipv4 target",
+            target: "192.0.2.10:80",
+            want:   []byte{0x04, 0x01, 0x00, 0x50, 192, 0, 2, 10, 'u', 's', 'e', 'r', 0},
+        },
+        {
+            name:   "hostname resolved locally",
+            target: "httpbin.test:443",
+            want:   []byte{0x04, 0x01, 0x01, 0xbb, 198, 51, 100, 7, 'u', 's', 'e', 'r', 0},
+        },
+        {
+            name:   "unresolvable hostname falls back to socks4a",
+            target: "internal.test:8080",
+            want:   append([]byte{0x04, 0x01, 0x1f, 0x90, 0, 0, 0, 1, 'u', 's', 'e', 'r', 0}, "internal.test\x00"...),
+        },
+        {
+            name:          "socks4a opt-in leaves resolution to the proxy",
+            target:        "httpbin.test:443",
+            remoteResolve: true,
+            want:          append([]byte{0x04, 0x01, 0x01, 0xbb, 0, 0, 0, 1, 'u', 's', 'e', 'r', 0}, "httpbin.test\x00"...),
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            d, server := newTestSOCKS4(t, tt.remoteResolve, map[string]string{"httpbin.test": "198.51.100.7"})
+            received := fakeSOCKS4(t, server, len(tt.want), []byte{0x00, socks4Granted, 0, 0, 0, 0, 0, 0})
+
+            conn, err := d.DialContext(context.Background(), "tcp", tt.target)
+            if err != nil {
+                t.Fatalf("DialContext: %v", err)
+            }
+            conn.Close()
+
+            if got := <-received; !bytes.Equal(got, tt.want) {
+                t.Errorf("request = % x, want % x", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestSOCKS4Reply(t *testing.T) {
+    tests := []struct {
+        name    string
+        reply   []byte
+        wantErr string
+    }{
+        {"granted", []byte{0x00, socks4Granted, 0, 0, 0, 0, 0, 0}, ""},
+        {"granted with version 4", []byte{0x04, socks4Granted, 0, 0, 0, 0, 0, 0}, ""},
+        {"rejected", []byte{0x00, socks4Rejected, 0, 0, 0, 0, 0, 0}, "rejected"},
+        {"identd missing", []byte{0x00, socks4IdentdMissing, 0, 0, 0, 0, 0, 0}, "identd"},
+        {"bad version", []byte{0x05, socks4Granted, 0, 0, 0, 0, 0, 0}, "unexpected reply version"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            d, server := newTestSOCKS4(t, false, nil)
+            fakeSOCKS4(t, server, 13, tt.reply)
+
+            conn, err := d.DialContext(context.Background(), "tcp", "192.0.2.10:80")
+            if tt.wantErr == "" {
+                if err != nil {
+                    t.Fatalf("DialContext: %v", err)
+                }
+                conn.Close()
+                return
+            }
+            if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                t.Errorf("DialContext error = %v, want one containing %q", err, tt.wantErr)
+            }
+        })
+    }
+}
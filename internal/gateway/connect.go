@@ -0,0 +1,70 @@
+package gateway
+
+import (
+    "log/slog"
+    "net/http"
+)
+
+// ServeHTTP handles HTTP CONNECT requests by tunnelling them through a proxy
+// from the pool. Other methods are rejected.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodConnect {
+        http.Error(w, "only CONNECT is supported", http.StatusMethodNotAllowed)
+        return
+    }
+
+    hijacker, ok := w.(http.Hijacker)
+    if !ok {
+        http.Error(w, "hijacking not supported", http.StatusInternalServerError)
+        return
+    }
+
+    // The Proxy-Authorization username doubles as the session ID
+    sessionID := ""
+    if username, _, ok := proxyBasicAuth(r); ok {
+        sessionID = username
+    }
+
+    upstream, _, err := g.dialUpstream(r.Context(), r.Host, sessionID)
+    if err != nil {
+        slog.Warn("Gateway could not reach target", "target", r.Host, "client", r.RemoteAddr, "error", err)
+        http.Error(w, "no upstream proxy could reach the target", http.StatusBadGateway)
+        return
+    }
+
+    conn, buffered, err := hijacker.Hijack()
+    if err != nil {
+        upstream.Close()
+        slog.Error("Gateway failed to hijack connection", "client", r.RemoteAddr, "error", err)
+        return
+    }
+
+    if _, err := conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+        conn.Close()
+        upstream.Close()
+        return
+    }
+
+    // Forward anything the client sent before the tunnel was up
+    if n := buffered.Reader.Buffered(); n > 0 {
+        data, _ := buffered.Reader.Peek(n)
+        if _, err := upstream.Write(data); err != nil {
+            conn.Close()
+            upstream.Close()
+            return
+        }
+    }
+
+    pipe(conn, upstream)
+}
+
+// proxyBasicAuth returns the credentials from the Proxy-Authorization header
+func proxyBasicAuth(r *http.Request) (string, string, bool) {
+    header := r.Header.Get("Proxy-Authorization")
+    if header == "" {
+        return "", "", false
+    }
+    // Reuse the standard Basic auth parser on the proxy header
+    probe := &http.Request{Header: http.Header{"Authorization": {header}}}
+    return probe.BasicAuth()
+}
@@ -0,0 +1,127 @@
+package gateway
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "log/slog"
+    "net"
+    "sync"
+    "time"
+
+    "proxy-system/internal/dialer"
+    "proxy-system/internal/models"
+)
+
+// Options tunes how the gateway dials upstream proxies
+type Options struct {
+    MaxAttempts int           // Upstream proxies tried per connection
+    DialTimeout time.Duration // Timeout for reaching the target through one upstream
+    SessionTTL  time.Duration // How long a session stays pinned after its last use
+}
+
+// Gateway forwards client connections through proxies chosen from the pool,
+// failing over to another proxy when an upstream cannot be reached. Clients
+// that send a session ID are pinned to the same upstream while it stays healthy.
+type Gateway struct {
+    pool     *Pool
+    selector Selector
+    sessions SessionStore
+    options  Options
+}
+
+func New(pool *Pool, selector Selector, sessions SessionStore, options Options) *Gateway {
+    return &Gateway{
+        pool:     pool,
+        selector: selector,
+        sessions: sessions,
+        options:  options,
+    }
+}
+
+// dialUpstream connects to target through a proxy from the pool, trying up to
+// MaxAttempts different proxies. A session's pinned proxy is tried first while
+// it is still healthy, and the session is pinned to whichever proxy connects.
+func (g *Gateway) dialUpstream(ctx context.Context, target, sessionID string) (net.Conn, *models.ProxyData, error) {
+    tried := make(map[string]bool)
+    var lastErr error
+
+    for attempt := 1; attempt <= g.options.MaxAttempts; attempt++ {
+        var proxy *models.ProxyData
+        if attempt == 1 && sessionID != "" {
+            if key, ok := g.sessions.Get(sessionID); ok {
+                if pinned, healthy := g.pool.Lookup(key); healthy {
+                    proxy = pinned
+                } else {
+                    slog.Info("Gateway session lost its pinned proxy, picking a new one", "session", sessionID, "proxy", key)
+                    g.sessions.Delete(sessionID)
+                }
+            }
+        }
+        if proxy == nil {
+            proxy = g.selector.Select(g.pool.Candidates(tried))
+        }
+        if proxy == nil {
+            break
+        }
+        key := proxy.GetKey()
+        tried[key] = true
+
+        conn, err := g.dialThrough(ctx, proxy, target)
+        if err == nil {
+            if sessionID != "" {
+                g.sessions.Set(sessionID, key, g.options.SessionTTL)
+            }
+            return conn, proxy, nil
+        }
+
+        slog.Warn("Gateway upstream failed", "proxy", key, "target", target, "attempt", attempt, "max_attempts", g.options.MaxAttempts, "error", err)
+        g.pool.MarkFailed(key)
+        if sessionID != "" {
+            g.sessions.Delete(sessionID)
+        }
+        lastErr = err
+    }
+
+    if lastErr == nil {
+        return nil, nil, fmt.Errorf("no healthy proxies available")
+    }
+    return nil, nil, fmt.Errorf("all upstream attempts failed, last error: %v", lastErr)
+}
+
+// dialThrough connects to target through a single proxy
+func (g *Gateway) dialThrough(ctx context.Context, proxy *models.ProxyData, target string) (net.Conn, error) {
+    protocol := tunnelProtocol(proxy)
+    d, err := dialer.ForProtocol(protocol, proxy.GetKey())
+    if err != nil {
+        return nil, err
+    }
+
+    dialCtx, cancel := context.WithTimeout(ctx, g.options.DialTimeout)
+    defer cancel()
+
+    return d.DialContext(dialCtx, "tcp", target)
+}
+
+// pipe copies data both ways until either side is done, then closes both
+func pipe(client, upstream net.Conn) {
+    var once sync.Once
+    closeBoth := func() {
+        client.Close()
+        upstream.Close()
+    }
+
+    var wg sync.WaitGroup
+    wg.Add(2)
+    go func() {
+        defer wg.Done()
+        io.Copy(upstream, client)
+        once.Do(closeBoth)
+    }()
+    go func() {
+        defer wg.Done()
+        io.Copy(client, upstream)
+        once.Do(closeBoth)
+    }()
+    wg.Wait()
+}
@@ -0,0 +1,146 @@
+package gateway
+
+import (
+    "context"
+    "log/slog"
+    "sync"
+    "time"
+
+    "proxy-system/internal/models"
+    "proxy-system/internal/storage"
+)
+
+// failureCooldown is how long a proxy is skipped after an upstream failure
+const failureCooldown = time.Minute
+
+// tunnelProtocols are the protocols the gateway can forward through, most
+// preferred first
+var tunnelProtocols = []string{"socks5", "socks4", "https"}
+
+// Pool is the set of healthy proxies the gateway chooses from, refreshed
+// from storage in the background
+type Pool struct {
+    storage storage.ProxyStore
+
+    mu       sync.RWMutex
+    proxies  []models.ProxyData
+    failedAt map[string]time.Time
+}
+
+func NewPool(store storage.ProxyStore) *Pool {
+    return &Pool{
+        storage:  store,
+        failedAt: make(map[string]time.Time),
+    }
+}
+
+// Refresh reloads the pool from storage, keeping only proxies with a protocol
+// the gateway can tunnel through. Expired proxies waiting to be deleted and
+// proxies a worker holds a lease on are left out.
+func (p *Pool) Refresh(ctx context.Context) error {
+    stored, err := p.storage.QueryProxies(ctx, storage.ProxyFilter{})
+    if err != nil {
+        return err
+    }
+
+    now := time.Now()
+    proxies := make([]models.ProxyData, 0, len(stored))
+    for _, proxy := range stored {
+        if proxy.Expired(now) || proxy.Leased(now) {
+            continue
+        }
+        if tunnelProtocol(&proxy) != "" {
+            proxies = append(proxies, proxy)
+        }
+    }
+
+    p.mu.Lock()
+    p.proxies = proxies
+    for key, failedAt := range p.failedAt {
+        if now.Sub(failedAt) > failureCooldown {
+            delete(p.failedAt, key)
+        }
+    }
+    p.mu.Unlock()
+
+    slog.Info("Gateway pool refreshed", "proxies", len(proxies))
+    return nil
+}
+
+// Run refreshes the pool on every interval until ctx is done
+func (p *Pool) Run(ctx context.Context, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+            if err := p.Refresh(ctx); err != nil {
+                slog.Error("Failed to refresh gateway pool", "error", err)
+            }
+        }
+    }
+}
+
+// Candidates returns the proxies that are not cooling down after a failure
+// and not in exclude
+func (p *Pool) Candidates(exclude map[string]bool) []models.ProxyData {
+    p.mu.RLock()
+    defer p.mu.RUnlock()
+
+    now := time.Now()
+    candidates := make([]models.ProxyData, 0, len(p.proxies))
+    for _, proxy := range p.proxies {
+        key := proxy.GetKey()
+        if exclude[key] {
+            continue
+        }
+        if failedAt, ok := p.failedAt[key]; ok && now.Sub(failedAt) < failureCooldown {
+            continue
+        }
+        candidates = append(candidates, proxy)
+    }
+
+    return candidates
+}
+
+// Lookup returns the proxy with the given key if it is in the pool and not
+// cooling down after a failure
+func (p *Pool) Lookup(key string) (*models.ProxyData, bool) {
+    p.mu.RLock()
+    defer p.mu.RUnlock()
+
+    if failedAt, ok := p.failedAt[key]; ok && time.Since(failedAt) < failureCooldown {
+        return nil, false
+    }
+    for i := range p.proxies {
+        if p.proxies[i].GetKey() == key {
+            proxy := p.proxies[i]
+            return &proxy, true
+        }
+    }
+    return nil, false
+}
+
+// MarkFailed puts a proxy into cooldown after an upstream failure
+func (p *Pool) MarkFailed(key string) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    p.failedAt[key] = time.Now()
+}
+
+// tunnelProtocol returns the preferred protocol to tunnel through the proxy,
+// or an empty string if it has none
+func tunnelProtocol(proxy *models.ProxyData) string {
+    protocols := proxy.EffectiveProtocols()
+    for _, preferred := range tunnelProtocols {
+        for _, protocol := range protocols {
+            if protocol == preferred {
+                return protocol
+            }
+        }
+    }
+    return ""
+}
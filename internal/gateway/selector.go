@@ -0,0 +1,93 @@
+package gateway
+
+import (
+    "fmt"
+    "math/rand"
+    "sync/atomic"
+
+    "proxy-system/internal/models"
+)
+
+// Selection strategies
+const (
+    StrategyRoundRobin    = "round-robin"
+    StrategyRandom        = "random"
+    StrategyLowestLatency = "lowest-latency"
+    StrategyHealth        = "health"
+)
+
+// Selector picks the upstream proxy for a connection from the candidates
+type Selector interface {
+    Select(candidates []models.ProxyData) *models.ProxyData
+}
+
+// NewSelector returns the selector for a strategy name
+func NewSelector(strategy string) (Selector, error) {
+    switch strategy {
+    case StrategyRoundRobin:
+        return &roundRobinSelector{}, nil
+    case StrategyRandom:
+        return randomSelector{}, nil
+    case StrategyLowestLatency:
+        return lowestLatencySelector{}, nil
+    case StrategyHealth:
+        return healthSelector{}, nil
+    default:
+        return nil, fmt.Errorf("unknown selection strategy: %s", strategy)
+    }
+}
+
+type roundRobinSelector struct {
+    next atomic.Uint64
+}
+
+func (s *roundRobinSelector) Select(candidates []models.ProxyData) *models.ProxyData {
+    if len(candidates) == 0 {
+        return nil
+    }
+    i := s.next.Add(1) - 1
+    return &candidates[i%uint64(len(candidates))]
+}
+
+type randomSelector struct{}
+
+func (randomSelector) Select(candidates []models.ProxyData) *models.ProxyData {
+    if len(candidates) == 0 {
+        return nil
+    }
+    return &candidates[rand.Intn(len(candidates))]
+}
+
+// lowestLatencySelector picks the fastest proxy, ignoring proxies without a
+// known latency unless nothing else is left
+type lowestLatencySelector struct{}
+
+func (lowestLatencySelector) Select(candidates []models.ProxyData) *models.ProxyData {
+    var best *models.ProxyData
+    for i := range candidates {
+        latency := candidates[i].EffectiveLatencyMs()
+        if latency <= 0 {
+            continue
+        }
+        if best == nil || latency < best.EffectiveLatencyMs() {
+            best = &candidates[i]
+        }
+    }
+    if best == nil && len(candidates) > 0 {
+        best = &candidates[0]
+    }
+    return best
+}
+
+// healthSelector picks the proxy with the highest health score
+type healthSelector struct{}
+
+func (healthSelector) Select(candidates []models.ProxyData) *models.ProxyData {
+    var best *models.ProxyData
+    for i := range candidates {
+        if best == nil || candidates[i].HealthScore > best.HealthScore {
+            best = &candidates[i]
+        }
+    }
+    return best
+}
@@ -0,0 +1,77 @@
+package gateway
+
+import (
+    "sync"
+    "time"
+)
+
+// SessionStore pins client sessions to upstream proxies
+type SessionStore interface {
+    // Get returns the proxy key pinned to the session, if any
+    Get(sessionID string) (string, bool)
+    // Set pins the session to a proxy for ttl
+    Set(sessionID, proxyKey string, ttl time.Duration)
+    // Delete unpins the session
+    Delete(sessionID string)
+}
+
+type sessionEntry struct {
+    proxyKey  string
+    expiresAt time.Time
+}
+
+// MemorySessionStore keeps session pins in process memory
+type MemorySessionStore struct {
+    mu       sync.Mutex
+    sessions map[string]sessionEntry
+    lastGC   time.Time
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+    return &MemorySessionStore{
+        sessions: make(map[string]sessionEntry),
+        lastGC:   time.Now(),
+    }
+}
+
+func (s *MemorySessionStore) Get(sessionID string) (string, bool) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    entry, ok := s.sessions[sessionID]
+    if !ok {
+        return "", false
+    }
+    if time.Now().After(entry.expiresAt) {
+        delete(s.sessions, sessionID)
+        return "", false
+    }
+    return entry.proxyKey, true
+}
+
+func (s *MemorySessionStore) Set(sessionID, proxyKey string, ttl time.Duration) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    now := time.Now()
+    s.sessions[sessionID] = sessionEntry{
+        proxyKey:  proxyKey,
+        expiresAt: now.Add(ttl),
+    }
+
+    // Drop expired sessions now and then so abandoned ones do not pile up
+    if now.Sub(s.lastGC) > ttl {
+        for id, entry := range s.sessions {
+            if now.After(entry.expiresAt) {
+                delete(s.sessions, id)
+            }
+        }
+        s.lastGC = now
+    }
+}
+
+func (s *MemorySessionStore) Delete(sessionID string) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    delete(s.sessions, sessionID)
+}
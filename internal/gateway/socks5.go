@@ -0,0 +1,205 @@
+package gateway
+
+import (
+    "context"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "net"
+    "strconv"
+    "time"
+)
+
+// SOCKS5 wire constants
+const (
+    socks5Version         = 0x05
+    socks5AuthNone        = 0x00
+    socks5AuthPassword    = 0x02
+    socks5AuthNoneFound   = 0xff
+    socks5CmdConnect      = 0x01
+    socks5AddrIPv4        = 0x01
+    socks5AddrDomain      = 0x03
+    socks5AddrIPv6        = 0x04
+    socks5ReplySucceeded  = 0x00
+    socks5ReplyFailure    = 0x01
+    socks5ReplyCmdNotSup  = 0x07
+    socks5ReplyAddrNotSup = 0x08
+)
+
+// handshakeTimeout bounds how long a client may take to send its greeting and
+// request. Dialing the upstream is bounded by the dial timeouts instead.
+const handshakeTimeout = 30 * time.Second
+
+// ServeSOCKS5 accepts SOCKS5 clients on the listener until it is closed.
+// Upstream dials in progress are cancelled once ctx is done.
+func (g *Gateway) ServeSOCKS5(ctx context.Context, listener net.Listener) error {
+    for {
+        conn, err := listener.Accept()
+        if err != nil {
+            if errors.Is(err, net.ErrClosed) {
+                return nil
+            }
+            return err
+        }
+        go g.handleSOCKS5(ctx, conn)
+    }
+}
+
+func (g *Gateway) handleSOCKS5(ctx context.Context, conn net.Conn) {
+    conn.SetDeadline(time.Now().Add(handshakeTimeout))
+
+    target, sessionID, err := g.socks5Handshake(conn)
+    if err != nil {
+        slog.Debug("Gateway SOCKS5 handshake failed", "client", conn.RemoteAddr().String(), "error", err)
+        conn.Close()
+        return
+    }
+    // The handshake deadline would cut failover across upstreams short
+    conn.SetDeadline(time.Time{})
+
+    upstream, _, err := g.dialUpstream(ctx, target, sessionID)
+    if err != nil {
+        slog.Warn("Gateway could not reach target", "target", target, "client", conn.RemoteAddr().String(), "error", err)
+        conn.Write([]byte{socks5Version, socks5ReplyFailure, 0, socks5AddrIPv4, 0, 0, 0, 0, 0, 0})
+        conn.Close()
+        return
+    }
+
+    if _, err := conn.Write([]byte{socks5Version, socks5ReplySucceeded, 0, socks5AddrIPv4, 0, 0, 0, 0, 0, 0}); err != nil {
+        conn.Close()
+        upstream.Close()
+        return
+    }
+
+    pipe(conn, upstream)
+}
+
+// socks5Handshake negotiates authentication and reads the CONNECT request,
+// returning the requested target address and the session ID, which is the
+// username of clients that authenticate. Passwords are not checked.
+func (g *Gateway) socks5Handshake(conn net.Conn) (string, string, error) {
+    header := make([]byte, 2)
+    if _, err := io.ReadFull(conn, header); err != nil {
+        return "", "", err
+    }
+    if header[0] != socks5Version {
+        return "", "", fmt.Errorf("unsupported version %d", header[0])
+    }
+
+    methods := make([]byte, header[1])
+    if _, err := io.ReadFull(conn, methods); err != nil {
+        return "", "", err
+    }
+
+    // Prefer username/password so clients that send a session ID get to use it
+    method := byte(socks5AuthNoneFound)
+    for _, m := range methods {
+        if m == socks5AuthPassword {
+            method = socks5AuthPassword
+            break
+        }
+        if m == socks5AuthNone {
+            method = socks5AuthNone
+        }
+    }
+    if _, err := conn.Write([]byte{socks5Version, method}); err != nil {
+        return "", "", err
+    }
+    if method == socks5AuthNoneFound {
+        return "", "", fmt.Errorf("no acceptable authentication method")
+    }
+
+    var sessionID string
+    if method == socks5AuthPassword {
+        username, err := readSOCKS5Credentials(conn)
+        if err != nil {
+            return "", "", err
+        }
+        sessionID = username
+    }
+
+    target, err := readSOCKS5Request(conn)
+    return target, sessionID, err
+}
+
+// readSOCKS5Credentials runs the RFC 1929 username/password subnegotiation,
+// accepting any credentials, and returns the username
+func readSOCKS5Credentials(conn net.Conn) (string, error) {
+    header := make([]byte, 2)
+    if _, err := io.ReadFull(conn, header); err != nil {
+        return "", err
+    }
+    if header[0] != 0x01 {
+        return "", fmt.Errorf("unsupported auth version %d", header[0])
+    }
+
+    username := make([]byte, header[1])
+    if _, err := io.ReadFull(conn, username); err != nil {
+        return "", err
+    }
+
+    passwordLength := make([]byte, 1)
+    if _, err := io.ReadFull(conn, passwordLength); err != nil {
+        return "", err
+    }
+    if _, err := io.CopyN(io.Discard, conn, int64(passwordLength[0])); err != nil {
+        return "", err
+    }
+
+    if _, err := conn.Write([]byte{0x01, 0x00}); err != nil {
+        return "", err
+    }
+
+    return string(username), nil
+}
+
+// readSOCKS5Request reads a request and returns its target as host:port
+func readSOCKS5Request(conn net.Conn) (string, error) {
+    request := make([]byte, 4)
+    if _, err := io.ReadFull(conn, request); err != nil {
+        return "", err
+    }
+    if request[0] != socks5Version {
+        return "", fmt.Errorf("unsupported version %d", request[0])
+    }
+    if request[1] != socks5CmdConnect {
+        conn.Write([]byte{socks5Version, socks5ReplyCmdNotSup, 0, socks5AddrIPv4, 0, 0, 0, 0, 0, 0})
+        return "", fmt.Errorf("unsupported command %d", request[1])
+    }
+
+    var host string
+    switch request[3] {
+    case socks5AddrIPv4, socks5AddrIPv6:
+        size := net.IPv4len
+        if request[3] == socks5AddrIPv6 {
+            size = net.IPv6len
+        }
+        ip := make([]byte, size)
+        if _, err := io.ReadFull(conn, ip); err != nil {
+            return "", err
+        }
+        host = net.IP(ip).String()
+    case socks5AddrDomain:
+        length := make([]byte, 1)
+        if _, err := io.ReadFull(conn, length); err != nil {
+            return "", err
+        }
+        domain := make([]byte, length[0])
+        if _, err := io.ReadFull(conn, domain); err != nil {
+            return "", err
+        }
+        host = string(domain)
+    default:
+        conn.Write([]byte{socks5Version, socks5ReplyAddrNotSup, 0, socks5AddrIPv4, 0, 0, 0, 0, 0, 0})
+        return "", fmt.Errorf("unsupported address type %d", request[3])
+    }
+
+    port := make([]byte, 2)
+    if _, err := io.ReadFull(conn, port); err != nil {
+        return "", err
+    }
+
+    return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
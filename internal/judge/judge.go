@@ -0,0 +1,163 @@
+package judge
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "strings"
+    "time"
+)
+
+// Anonymity levels, from least to most anonymous
+const (
+    AnonymityTransparent = "transparent" // Our own IP reached the judge
+    AnonymityAnonymous   = "anonymous"   // Our IP was hidden but the proxy announced itself
+    AnonymityElite       = "elite"       // Nothing showed that a proxy was involved
+)
+
+// proxyHeaders are request headers that proxies add to reveal themselves or
+// the client they are forwarding for
+var proxyHeaders = []string{
+    "Via",
+    "Forwarded",
+    "Forwarded-For",
+    "X-Forwarded",
+    "X-Forwarded-For",
+    "X-Forwarded-Host",
+    "X-Forwarded-Proto",
+    "X-Real-IP",
+    "X-Client-IP",
+    "X-Originating-IP",
+    "X-Cluster-Client-IP",
+    "X-Proxy-ID",
+    "Client-IP",
+    "True-Client-IP",
+    "Proxy-Connection",
+}
+
+// Report is what the judge saw of a single request
+type Report struct {
+    RemoteIP string            `json:"remote_ip"`
+    Headers  map[string]string `json:"headers"`
+}
+
+// Handler answers every request with a JSON Report describing it
+func Handler() http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        report := Report{
+            Headers: make(map[string]string, len(r.Header)),
+        }
+
+        if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+            report.RemoteIP = host
+        } else {
+            report.RemoteIP = r.RemoteAddr
+        }
+        for name, values := range r.Header {
+            report.Headers[name] = strings.Join(values, ", ")
+        }
+
+        w.Header().Set("Content-Type", "application/json")
+        w.Header().Set("Cache-Control", "no-store")
+        json.NewEncoder(w).Encode(report)
+    })
+}
+
+// Server is an embeddable judge listening on its own address
+type Server struct {
+    httpServer *http.Server
+    listener   net.Listener
+}
+
+// Start listens on addr and serves the judge in the background. Use an
+// address like 127.0.0.1:0 to get a free local port.
+func Start(addr string) (*Server, error) {
+    listener, err := net.Listen("tcp", addr)
+    if err != nil {
+        return nil, fmt.Errorf("failed to listen on %s: %v", addr, err)
+    }
+
+    s := &Server{
+        httpServer: &http.Server{
+            Handler:           Handler(),
+            ReadHeaderTimeout: 10 * time.Second,
+        },
+        listener: listener,
+    }
+    go s.httpServer.Serve(listener)
+
+    return s, nil
+}
+
+// Addr returns the address the judge is listening on
+func (s *Server) Addr() string {
+    return s.listener.Addr().String()
+}
+
+// URL returns a URL that reaches the judge from this host
+func (s *Server) URL() string {
+    return "http://" + s.Addr() + "/"
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+    return s.httpServer.Shutdown(ctx)
+}
+
+// Fetch requests the judge at judgeURL with the client and decodes its report
+func Fetch(ctx context.Context, httpClient *http.Client, judgeURL string) (*Report, error) {
+    req, err := http.NewRequestWithContext(ctx, "GET", judgeURL, nil)
+    if err != nil {
+        return nil, err
+    }
+
+    resp, err := httpClient.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("judge returned status %d", resp.StatusCode)
+    }
+
+    var report Report
+    if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&report); err != nil {
+        return nil, fmt.Errorf("failed to decode judge report: %v", err)
+    }
+
+    return &report, nil
+}
+
+// Classify works out the anonymity level of a proxy from the report the judge
+// produced for a request sent through it. originIPs are the addresses the
+// request came from before it entered the proxy.
+func Classify(report *Report, originIPs []string) string {
+    for _, ip := range originIPs {
+        if report.RemoteIP == ip {
+            return AnonymityTransparent
+        }
+    }
+
+    revealed := false
+    for _, name := range proxyHeaders {
+        value, ok := report.Headers[http.CanonicalHeaderKey(name)]
+        if !ok {
+            continue
+        }
+        revealed = true
+
+        for _, ip := range originIPs {
+            if strings.Contains(value, ip) {
+                return AnonymityTransparent
+            }
+        }
+    }
+
+    if revealed {
+        return AnonymityAnonymous
+    }
+    return AnonymityElite
+}
@@ -0,0 +1,118 @@
+package judge
+
+import (
+    "context"
+    "encoding/json"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "testing"
+)
+
+// originIP stands in for the public IP of this host. Everything in the test
+// runs on loopback, so the stand-in proxy leaks this address instead of the
+// one the request really came from.
+const originIP = "203.0.113.7"
+
+// forwardingProxy is a minimal HTTP forward proxy that adds the given headers
+// to every request it passes on
+func forwardingProxy(t *testing.T, headers map[string]string) *httptest.Server {
+    t.Helper()
+
+    transport := &http.Transport{}
+    t.Cleanup(transport.CloseIdleConnections)
+
+    proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        out, err := http.NewRequestWithContext(r.Context(), r.Method, r.URL.String(), r.Body)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        out.Header = r.Header.Clone()
+        for name, value := range headers {
+            out.Header.Set(name, value)
+        }
+
+        resp, err := transport.RoundTrip(out)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadGateway)
+            return
+        }
+        defer resp.Body.Close()
+
+        for name, values := range resp.Header {
+            w.Header()[name] = values
+        }
+        w.WriteHeader(resp.StatusCode)
+        io.Copy(w, resp.Body)
+    }))
+    t.Cleanup(proxy.Close)
+
+    return proxy
+}
+
+func TestClassifyThroughProxy(t *testing.T) {
+    judgeServer := httptest.NewServer(Handler())
+    defer judgeServer.Close()
+
+    tests := []struct {
+        name    string
+        headers map[string]string
+        want    string
+    }{
+        {"transparent", map[string]string{"X-Forwarded-For": originIP, "Via": "1.1 standin"}, AnonymityTransparent},
+        {"anonymous", map[string]string{"Via": "1.1 standin"}, AnonymityAnonymous},
+        {"elite", nil, AnonymityElite},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            proxy := forwardingProxy(t, tt.headers)
+            proxyURL, err := url.Parse(proxy.URL)
+            if err != nil {
+                t.Fatal(err)
+            }
+            httpClient := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+            report, err := Fetch(context.Background(), httpClient, judgeServer.URL)
+            if err != nil {
+                t.Fatalf("Fetch through proxy: %v", err)
+            }
+            if got := Classify(report, []string{originIP}); got != tt.want {
+                t.Errorf("Classify = %q, want %q (report %+v)", got, tt.want, report)
+            }
+        })
+    }
+}
+
+func TestClassifyOwnRemoteIP(t *testing.T) {
+    report := &Report{RemoteIP: originIP, Headers: map[string]string{}}
+    if got := Classify(report, []string{originIP}); got != AnonymityTransparent {
+        t.Errorf("Classify = %q, want %q", got, AnonymityTransparent)
+    }
+}
+
+func TestHandlerReportsHeaders(t *testing.T) {
+    req := httptest.NewRequest("GET", "/", nil)
+    req.RemoteAddr = "198.51.100.1:4321"
+    req.Header.Add("X-Forwarded-For", "10.0.0.1")
+    req.Header.Add("X-Forwarded-For", "10.0.0.2")
+    rec := httptest.NewRecorder()
+
+    Handler().ServeHTTP(rec, req)
+
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+    }
+    var report Report
+    if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+        t.Fatalf("failed to decode report: %v", err)
+    }
+    if report.RemoteIP != "198.51.100.1" {
+        t.Errorf("RemoteIP = %q, want %q", report.RemoteIP, "198.51.100.1")
+    }
+    if got := report.Headers["X-Forwarded-For"]; got != "10.0.0.1, 10.0.0.2" {
+        t.Errorf("X-Forwarded-For = %q, want %q", got, "10.0.0.1, 10.0.0.2")
+    }
+}
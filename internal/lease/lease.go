@@ -0,0 +1,89 @@
+package lease
+
+import (
+    "context"
+    "fmt"
+    "time"
+
+    "proxy-system/internal/models"
+    "proxy-system/internal/storage"
+)
+
+// MaxCheckout caps how many proxies one checkout may lease
+const MaxCheckout = 100
+
+// Outcome is what a worker reports about a proxy when it releases the lease
+type Outcome string
+
+const (
+    OutcomeSuccess Outcome = "success"
+    OutcomeFailure Outcome = "failure"
+)
+
+// ParseOutcome validates an outcome given as text
+func ParseOutcome(value string) (Outcome, error) {
+    switch outcome := Outcome(value); outcome {
+    case OutcomeSuccess, OutcomeFailure:
+        return outcome, nil
+    default:
+        return "", fmt.Errorf("invalid outcome: %s (expected %s or %s)", value, OutcomeSuccess, OutcomeFailure)
+    }
+}
+
+// Lease is an exclusive hold on a proxy by one worker until Expiry
+type Lease struct {
+    Owner  string           `json:"owner"`
+    Expiry time.Time        `json:"expiry"`
+    Proxy  models.ProxyData `json:"proxy"`
+}
+
+// Manager hands out exclusive, time-bounded leases on stored proxies so
+// workers sharing a table do not all use the same proxies
+type Manager struct {
+    storage     storage.ProxyStore
+    maxDuration time.Duration
+}
+
+// NewManager creates a manager whose leases last at most maxDuration
+func NewManager(store storage.ProxyStore, maxDuration time.Duration) *Manager {
+    return &Manager{
+        storage:     store,
+        maxDuration: maxDuration,
+    }
+}
+
+// Checkout leases up to count proxies matching the filter to owner. A zero
+// duration, or one above the maximum, leases for the maximum. Fewer leases
+// than requested are returned when not enough proxies are free.
+func (m *Manager) Checkout(ctx context.Context, owner string, filter storage.ProxyFilter, count int, duration time.Duration) ([]Lease, error) {
+    if owner == "" {
+        return nil, fmt.Errorf("lease owner is required")
+    }
+    if count < 1 || count > MaxCheckout {
+        return nil, fmt.Errorf("lease count must be between 1 and %d", MaxCheckout)
+    }
+    if duration <= 0 || duration > m.maxDuration {
+        duration = m.maxDuration
+    }
+
+    proxies, err := m.storage.AcquireLeases(ctx, owner, filter, count, duration, time.Now())
+    if err != nil {
+        return nil, fmt.Errorf("failed to acquire leases: %v", err)
+    }
+
+    leases := make([]Lease, len(proxies))
+    for i, proxy := range proxies {
+        leases[i] = Lease{Owner: owner, Expiry: proxy.LeaseExpiry, Proxy: proxy}
+    }
+    return leases, nil
+}
+
+// Release gives back owner's lease on the proxy and records the outcome. It
+// returns storage.ErrLeaseNotHeld if the lease expired and was taken by
+// someone else, or was never held.
+func (m *Manager) Release(ctx context.Context, owner, proxyKey string, outcome Outcome) error {
+    if owner == "" {
+        return fmt.Errorf("lease owner is required")
+    }
+    return m.storage.ReleaseLease(ctx, proxyKey, owner, outcome == OutcomeSuccess)
+}
@@ -0,0 +1,143 @@
+package metrics
+
+import (
+    "net/http"
+    "time"
+
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/collectors"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var registry = prometheus.NewRegistry()
+
+var (
+    fetchAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "proxy_fetch_attempts_total",
+        Help: "Fetch attempts per proxy source, retries included.",
+    }, []string{"source"})
+    fetchErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "proxy_fetch_errors_total",
+        Help: "Failed fetch attempts per proxy source.",
+    }, []string{"source"})
+    fetchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+        Name:    "proxy_fetch_duration_seconds",
+        Help:    "Duration of fetch attempts per proxy source.",
+        Buckets: prometheus.ExponentialBuckets(0.25, 2, 10),
+    }, []string{"source"})
+    fetchedProxies = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "proxy_fetched_proxies_total",
+        Help: "Proxies returned by successful fetches per proxy source.",
+    }, []string{"source"})
+
+    validations = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "proxy_validations_total",
+        Help: "Proxy validations per protocol and outcome (passed or failed).",
+    }, []string{"protocol", "outcome"})
+    validationLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+        Name:    "proxy_validation_first_byte_seconds",
+        Help:    "First-byte latency of passed validations per protocol.",
+        Buckets: prometheus.ExponentialBuckets(0.05, 2, 10),
+    }, []string{"protocol"})
+
+    dynamoRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "dynamodb_requests_total",
+        Help: "DynamoDB requests per operation, after SDK retries.",
+    }, []string{"operation"})
+    dynamoErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "dynamodb_errors_total",
+        Help: "DynamoDB requests that failed per operation, after SDK retries.",
+    }, []string{"operation"})
+    dynamoThrottles = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "dynamodb_throttles_total",
+        Help: "Throttled DynamoDB request attempts and throttled batch entries per operation.",
+    }, []string{"operation"})
+    dynamoCapacity = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "dynamodb_consumed_capacity_units_total",
+        Help: "Capacity units consumed per DynamoDB operation.",
+    }, []string{"operation"})
+
+    poolSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+        Name: "proxy_pool_size",
+        Help: "Healthy stored proxies per country and validated protocol. A proxy counts once for every protocol it supports.",
+    }, []string{"country", "protocol"})
+    poolHealthy = prometheus.NewGauge(prometheus.GaugeOpts{
+        Name: "proxy_pool_healthy",
+        Help: "Healthy stored proxies, those with at least one working protocol that have not expired.",
+    })
+    poolStored = prometheus.NewGauge(prometheus.GaugeOpts{
+        Name: "proxy_pool_stored",
+        Help: "Stored proxies, healthy or not.",
+    })
+)
+
+func init() {
+    registry.MustRegister(
+        collectors.NewGoCollector(),
+        collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+        fetchAttempts, fetchErrors, fetchDuration, fetchedProxies,
+        validations, validationLatency,
+        dynamoRequests, dynamoErrors, dynamoThrottles, dynamoCapacity,
+        poolSize, poolHealthy, poolStored,
+    )
+}
+
+// Handler serves every metric in the Prometheus text format
+func Handler() http.Handler {
+    return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ObserveFetch records one fetch attempt against a source
+func ObserveFetch(source string, duration time.Duration, fetched int, err error) {
+    fetchAttempts.WithLabelValues(source).Inc()
+    fetchDuration.WithLabelValues(source).Observe(duration.Seconds())
+    if err != nil {
+        fetchErrors.WithLabelValues(source).Inc()
+        return
+    }
+    fetchedProxies.WithLabelValues(source).Add(float64(fetched))
+}
+
+// ObserveValidation records the outcome of validating a proxy over one protocol
+func ObserveValidation(protocol string, passed bool, firstByte time.Duration) {
+    if !passed {
+        validations.WithLabelValues(protocol, "failed").Inc()
+        return
+    }
+    validations.WithLabelValues(protocol, "passed").Inc()
+    validationLatency.WithLabelValues(protocol).Observe(firstByte.Seconds())
+}
+
+// ObserveDynamoRequest records a finished DynamoDB request
+func ObserveDynamoRequest(operation string, failed bool) {
+    dynamoRequests.WithLabelValues(operation).Inc()
+    if failed {
+        dynamoErrors.WithLabelValues(operation).Inc()
+    }
+}
+
+// ObserveDynamoThrottle records throttled DynamoDB attempts or batch entries
+func ObserveDynamoThrottle(operation string, count int) {
+    dynamoThrottles.WithLabelValues(operation).Add(float64(count))
+}
+
+// ObserveDynamoCapacity records capacity units consumed by a DynamoDB request
+func ObserveDynamoCapacity(operation string, units float64) {
+    dynamoCapacity.WithLabelValues(operation).Add(units)
+}
+
+// PoolKey identifies a pool size gauge
+type PoolKey struct {
+    Country  string
+    Protocol string
+}
+
+// SetPoolSize replaces the pool gauges with a fresh count of the stored proxies
+func SetPoolSize(sizes map[PoolKey]int, healthy, stored int) {
+    poolSize.Reset()
+    for key, size := range sizes {
+        poolSize.WithLabelValues(key.Country, key.Protocol).Set(float64(size))
+    }
+    poolHealthy.Set(float64(healthy))
+    poolStored.Set(float64(stored))
+}
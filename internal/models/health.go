@@ -0,0 +1,58 @@
+package models
+
+import (
+    "math"
+    "time"
+)
+
+// healthLatencyReferenceMs is the latency that halves a proxy's speed factor
+const healthLatencyReferenceMs = 1000
+
+// UpdateHealth folds one validation outcome into the proxy's history and
+// recomputes HealthScore. The success and failure counts are decayed by
+// halfLife for the time since the previous validation, so recent results
+// outweigh old ones.
+func (p *ProxyData) UpdateHealth(since time.Time, passed bool, now time.Time, halfLife time.Duration) {
+    if !since.IsZero() && now.After(since) {
+        decay := decayFactor(now.Sub(since), halfLife)
+        p.HealthSuccesses *= decay
+        p.HealthFailures *= decay
+    }
+
+    if passed {
+        p.HealthSuccesses++
+        p.LastSuccessAt = now
+    } else {
+        p.HealthFailures++
+    }
+
+    p.HealthScore = p.healthScore(now, halfLife)
+}
+
+// healthScore combines reliability, speed and freshness into a score between
+// 0 and 1, higher being better
+func (p *ProxyData) healthScore(now time.Time, halfLife time.Duration) float64 {
+    // Smoothed success rate, so a single result does not read as 0% or 100%
+    reliability := (p.HealthSuccesses + 1) / (p.HealthSuccesses + p.HealthFailures + 2)
+
+    speed := 0.5
+    if latency := p.EffectiveLatencyMs(); latency > 0 {
+        speed = healthLatencyReferenceMs / (healthLatencyReferenceMs + latency)
+    }
+
+    // A proxy that never passed has nothing to vouch for it
+    if p.LastSuccessAt.IsZero() {
+        return 0
+    }
+    freshness := decayFactor(now.Sub(p.LastSuccessAt), halfLife)
+
+    return reliability * speed * freshness
+}
+
+// decayFactor returns how much weight is left after elapsed, halving every halfLife
+func decayFactor(elapsed, halfLife time.Duration) float64 {
+    if halfLife <= 0 || elapsed <= 0 {
+        return 1
+    }
+    return math.Pow(0.5, float64(elapsed)/float64(halfLife))
+}
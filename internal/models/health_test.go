@@ -0,0 +1,112 @@
+package models
+
+import (
+    "math"
+    "math/rand"
+    "testing"
+    "time"
+)
+
+func TestDecayFactor(t *testing.T) {
+    const halfLife = 6 * time.Hour
+
+    tests := []struct {
+        name     string
+        elapsed  time.Duration
+        halfLife time.Duration
+        want     float64
+    }{
+        {"no time passed", 0, halfLife, 1},
+        {"one half-life", halfLife, halfLife, 0.5},
+        {"two half-lives", 2 * halfLife, halfLife, 0.25},
+        {"half a half-life", halfLife / 2, halfLife, math.Sqrt(0.5)},
+        {"clock went backwards", -time.Hour, halfLife, 1},
+        {"decay disabled", time.Hour, 0, 1},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := decayFactor(tt.elapsed, tt.halfLife); math.Abs(got-tt.want) > 1e-9 {
+                t.Errorf("decayFactor(%v, %v) = %v, want %v", tt.elapsed, tt.halfLife, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestUpdateHealthDecaysHistory(t *testing.T) {
+    const halfLife = 6 * time.Hour
+    now := time.Now()
+
+    tests := []struct {
+        name          string
+        since         time.Time
+        passed        bool
+        wantSuccesses float64
+        wantFailures  float64
+    }{
+        {"pass after one half-life", now.Add(-halfLife), true, 3, 1},
+        {"fail after one half-life", now.Add(-halfLife), false, 2, 2},
+        {"pass after two half-lives", now.Add(-2 * halfLife), true, 2, 0.5},
+        {"first validation", time.Time{}, true, 5, 2},
+        {"validated again at once", now, false, 4, 3},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            p := &ProxyData{HealthSuccesses: 4, HealthFailures: 2}
+            p.UpdateHealth(tt.since, tt.passed, now, halfLife)
+
+            if math.Abs(p.HealthSuccesses-tt.wantSuccesses) > 1e-9 || math.Abs(p.HealthFailures-tt.wantFailures) > 1e-9 {
+                t.Errorf("history = %v successes, %v failures, want %v and %v", p.HealthSuccesses, p.HealthFailures, tt.wantSuccesses, tt.wantFailures)
+            }
+            if tt.passed != p.LastSuccessAt.Equal(now) {
+                t.Errorf("LastSuccessAt = %v after passed = %v", p.LastSuccessAt, tt.passed)
+            }
+        })
+    }
+}
+
+func TestHealthScore(t *testing.T) {
+    const halfLife = 6 * time.Hour
+    now := time.Now()
+
+    t.Run("never passed", func(t *testing.T) {
+        p := &ProxyData{}
+        p.UpdateHealth(time.Time{}, false, now, halfLife)
+        if p.HealthScore != 0 {
+            t.Errorf("HealthScore = %v, want 0 for a proxy that never passed", p.HealthScore)
+        }
+    })
+
+    t.Run("success goes stale", func(t *testing.T) {
+        p := &ProxyData{FirstByteLatencyMs: healthLatencyReferenceMs}
+        p.UpdateHealth(time.Time{}, true, now, halfLife)
+        // Reliability 2/3 after one pass, speed 1/2 at the reference latency
+        if want := 1.0 / 3; math.Abs(p.HealthScore-want) > 1e-9 {
+            t.Errorf("fresh HealthScore = %v, want %v", p.HealthScore, want)
+        }
+
+        fresh := p.HealthScore
+        if stale := p.healthScore(now.Add(halfLife), halfLife); math.Abs(stale-fresh/2) > 1e-9 {
+            t.Errorf("HealthScore one half-life after the last success = %v, want %v", stale, fresh/2)
+        }
+    })
+
+    t.Run("stays between 0 and 1", func(t *testing.T) {
+        rng := rand.New(rand.NewSource(1))
+        for _, decay := range []time.Duration{0, time.Minute, halfLife} {
+            p := &ProxyData{}
+            at := now
+            var since time.Time
+            for i := 0; i < 1000; i++ {
+                p.FirstByteLatencyMs = []float64{0, 1, 250, 5000}[rng.Intn(4)]
+                p.UpdateHealth(since, rng.Intn(3) > 0, at, decay)
+                if p.HealthScore < 0 || p.HealthScore > 1 || math.IsNaN(p.HealthScore) {
+                    t.Fatalf("half-life %v, validation %d: HealthScore = %v, want it between 0 and 1", decay, i, p.HealthScore)
+                }
+                since = at
+                at = at.Add(time.Duration(rng.Int63n(int64(24 * time.Hour))))
+            }
+        }
+    })
+}
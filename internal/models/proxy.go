@@ -20,21 +20,42 @@ type ProxyData struct {
     ASN               string    `json:"asn" dynamodb:"asn"`
     City              string    `json:"city" dynamodb:"city"`
     Country           string    `json:"country" dynamodb:"country"`
-    CreatedAt         time.Time `json:"created_at" dynamodb:"created_at" dynamodbav:",unixtime"`
+    CreatedAt         time.Time `json:"created_at" dynamodb:"created_at" dynamodbav:"created_at,unixtime"`
     Google            bool      `json:"google" dynamodb:"google"`
     ISP               string    `json:"isp" dynamodb:"isp"`
-    LastChecked       time.Time `json:"lastChecked" dynamodb:"last_checked" dynamodbav:",unixtime"`
+    LastChecked       time.Time `json:"lastChecked" dynamodb:"last_checked" dynamodbav:"last_checked,unixtime"`
     Latency           float64   `json:"latency" dynamodb:"latency"`
     Org               string    `json:"org" dynamodb:"org"`
     Protocols         []string  `json:"protocols" dynamodb:"protocols"`
     Region            *string   `json:"region" dynamodb:"region"`
     ResponseTime      int       `json:"responseTime" dynamodb:"response_time"`
     Speed             int       `json:"speed" dynamodb:"speed"`
-    UpdatedAt         time.Time `json:"updated_at" dynamodb:"updated_at" dynamodbav:",unixtime"`
+    UpdatedAt         time.Time `json:"updated_at" dynamodb:"updated_at" dynamodbav:"updated_at,unixtime"`
     WorkingPercent    *float64  `json:"workingPercent" dynamodb:"working_percent"`
     UpTime            float64   `json:"upTime" dynamodb:"up_time"`
     UpTimeSuccessCount int      `json:"upTimeSuccessCount" dynamodb:"up_time_success_count"`
     UpTimeTryCount    int       `json:"upTimeTryCount" dynamodb:"up_time_try_count"`
+
+    // Our own validation results, as opposed to the provider's numbers above
+    ValidatedAt        time.Time `json:"validatedAt" dynamodb:"validated_at" dynamodbav:"validated_at,unixtime"`
+    ValidProtocols     []string  `json:"validProtocols" dynamodb:"valid_protocols"`
+    ConnectLatencyMs   float64   `json:"connectLatencyMs" dynamodb:"connect_latency_ms"`
+    FirstByteLatencyMs float64   `json:"firstByteLatencyMs" dynamodb:"first_byte_latency_ms"`
+    ValidationError    string    `json:"validationError" dynamodb:"validation_error"`
+    MeasuredAnonymity  string    `json:"measuredAnonymity" dynamodb:"measured_anonymity"`
+    ExpiresAt          time.Time `json:"expiresAt" dynamodb:"ttl" dynamodbav:"ttl,unixtime"`
+
+    // Decayed validation history and the score derived from it, see UpdateHealth
+    HealthScore     float64   `json:"healthScore" dynamodb:"health_score"`
+    HealthSuccesses float64   `json:"healthSuccesses" dynamodb:"health_successes"`
+    HealthFailures  float64   `json:"healthFailures" dynamodb:"health_failures"`
+    LastSuccessAt   time.Time `json:"lastSuccessAt" dynamodb:"last_success_at" dynamodbav:"last_success_at,unixtime"`
+
+    // Exclusive checkout by a worker, see storage.ProxyStore.AcquireLeases
+    LeaseOwner     string    `json:"leaseOwner" dynamodb:"lease_owner"`
+    LeaseExpiry    time.Time `json:"leaseExpiry" dynamodb:"lease_expiry" dynamodbav:"lease_expiry,unixtime"`
+    LeaseSuccesses int       `json:"leaseSuccesses" dynamodb:"lease_successes"`
+    LeaseFailures  int       `json:"leaseFailures" dynamodb:"lease_failures"`
 }
 
 // UnmarshalJSON custom unmarshaler to handle LastChecked as Unix timestamp
@@ -56,4 +77,44 @@ func (p *ProxyData) UnmarshalJSON(data []byte) error {
 // GetKey returns the primary key for DynamoDB
 func (p *ProxyData) GetKey() string {
     return p.IP + ":" + p.Port
-}
\ No newline at end of file
+}
+// EffectiveProtocols returns the protocols we validated, falling back to the
+// ones the provider advertises when the proxy was never validated by us
+func (p *ProxyData) EffectiveProtocols() []string {
+    if !p.ValidatedAt.IsZero() {
+        return p.ValidProtocols
+    }
+    return p.Protocols
+}
+
+// EffectiveAnonymity returns the anonymity level we measured, falling back to
+// the provider's claim
+func (p *ProxyData) EffectiveAnonymity() string {
+    if p.MeasuredAnonymity != "" {
+        return p.MeasuredAnonymity
+    }
+    return p.Anonymity
+}
+
+// EffectiveLatencyMs returns our measured first-byte latency, falling back to
+// the provider's latency
+func (p *ProxyData) EffectiveLatencyMs() float64 {
+    if p.FirstByteLatencyMs > 0 {
+        return p.FirstByteLatencyMs
+    }
+    return p.Latency
+}
+
+// Leased reports whether a worker holds an unexpired lease on the proxy
+func (p *ProxyData) Leased(now time.Time) bool {
+    return p.LeaseOwner != "" && now.Before(p.LeaseExpiry)
+}
+
+// Expired reports whether the proxy is past its expiry and only waiting to be
+// deleted
+func (p *ProxyData) Expired(now time.Time) bool {
+    return !p.ExpiresAt.IsZero() && p.ExpiresAt.Before(now)
+}
+
+// ProtocolPreference orders protocols from most to least capable
+var ProtocolPreference = []string{"socks5", "socks4", "https", "http"}
@@ -3,116 +3,294 @@ package service
 import (
     "context"
     "fmt"
-    "log"
+    "log/slog"
+    "math"
+    "math/rand"
+    "net"
     "net/http"
     "strings"
+    "sync"
     "time"
 
-    "golang.org/x/net/proxy"
     "proxy-system/internal/client"
     "proxy-system/internal/config"
+    "proxy-system/internal/judge"
+    "proxy-system/internal/metrics"
     "proxy-system/internal/models"
     "proxy-system/internal/storage"
 )
 
+// validationRefreshInterval is how old a stored validation may get before it
+// is rewritten even though nothing about it changed
+const validationRefreshInterval = 15 * time.Minute
+
+// healthScoreTolerance is how far the health score may move before it is
+// worth a write on its own
+const healthScoreTolerance = 0.05
+
 type ProxyService struct {
-    client  *client.GeoNodeClient
-    storage *storage.DynamoDBStorage
-    config  *config.Config
+    storage   storage.ProxyStore
+    originIPs []string // Our own addresses as seen by the anonymity judge
+
+    // Replaced by Reload
+    mu       sync.RWMutex
+    config   *config.Config
+    sources  []client.ProxySource
+    reloaded chan struct{} // Closed and replaced on every reload
+
+    // In-flight work, drained by Shutdown
+    work       context.Context // Cancelled when Shutdown stops waiting
+    cancelWork context.CancelFunc
+    workMu     sync.Mutex
+    draining   bool
+    running    map[string]int // Operations in flight by name
+    inFlight   sync.WaitGroup
 }
 
-func NewProxyService(cfg *config.Config) (*ProxyService, error) {
-    geoNodeClient := client.NewGeoNodeClient()
-    
-    dynamoStorage, err := storage.NewDynamoDBStorage(cfg)
-    if err != nil {
-        return nil, err
+func NewProxyService(cfg *config.Config, sources []client.ProxySource, store storage.ProxyStore) (*ProxyService, error) {
+    if len(sources) == 0 {
+        return nil, fmt.Errorf("no proxy sources configured")
     }
 
-    return &ProxyService{
-        client:  geoNodeClient,
-        storage: dynamoStorage,
-        config:  cfg,
-    }, nil
+    s := &ProxyService{
+        storage:   store,
+        originIPs: cfg.JudgeOriginIPs,
+        config:    cfg,
+        sources:   sources,
+        reloaded:  make(chan struct{}),
+        running:   make(map[string]int),
+    }
+    s.work, s.cancelWork = context.WithCancel(context.Background())
+
+    if cfg.JudgeURL != "" {
+        // Ask the judge directly so it tells us which address we come from
+        report, err := judge.Fetch(context.Background(), &http.Client{Timeout: cfg.ValidationTimeout}, cfg.JudgeURL)
+        switch {
+        case err != nil:
+            slog.Warn("Failed to discover origin IP from judge", "judge", cfg.JudgeURL, "error", err)
+        case isLoopback(report.RemoteIP):
+            // A local judge sees us as loopback, not as the public IP that
+            // transparent proxies leak
+            slog.Warn("Judge sees this host as a loopback address, not using it as origin IP", "judge", cfg.JudgeURL, "ip", report.RemoteIP)
+        default:
+            slog.Info("Judge sees this host", "ip", report.RemoteIP)
+            s.originIPs = append(s.originIPs, report.RemoteIP)
+        }
+        if len(s.originIPs) == 0 {
+            return nil, fmt.Errorf("anonymity checks need JUDGE_ORIGIN_IPS when the judge cannot be reached directly or only sees a loopback address")
+        }
+    }
+
+    return s, nil
 }
 
+func isLoopback(ip string) bool {
+    parsed := net.ParseIP(ip)
+    return parsed != nil && parsed.IsLoopback()
+}
+
+// Start runs update cycles, and the purge and revalidation in the background,
+// until ctx is done. Cancelling ctx only stops new work from starting; the
+// work in flight keeps going until Shutdown, which should be called next.
 func (s *ProxyService) Start(ctx context.Context) error {
-    log.Println("Proxy service started")
+    slog.Info("Proxy service started")
 
-    // Initial fetch
-    successful, err := s.updateProxies()
-    if err != nil {
-        log.Printf("Initial proxy update failed: %v", err)
-    } else if successful {
-        log.Println("Initial update successful, scheduling next in 1 minute")
-    } else {
-        log.Println("Initial update had no changes, not scheduling next")
+    go s.runPurge(ctx)
+    go s.runRevalidation(ctx)
+    go s.runPoolMetrics(ctx)
+
+    // Cycles run on a fixed interval whatever their outcome, backing off
+    // while they keep failing
+    var failures int
+    for {
+        var err error
+        started := ctx.Err() == nil && s.track("update cycle", func(ctx context.Context) {
+            _, err = s.updateProxies(ctx)
+        })
+        if !started {
+            slog.Info("Proxy service stopping")
+            return nil
+        }
+        if err != nil {
+            failures++
+        } else {
+            failures = 0
+        }
+
+        if err := s.waitForNextCycle(ctx, failures); err != nil {
+            slog.Info("Proxy service stopping")
+            return nil
+        }
     }
+}
+
+// waitForNextCycle waits out the delay before the next cycle. A reload
+// recomputes the delay from the new intervals, counted from the same start.
+func (s *ProxyService) waitForNextCycle(ctx context.Context, failures int) error {
+    start := time.Now()
+    delay := s.nextDelay(failures)
+    slog.Debug("Scheduling next update", "delay", delay.String(), "consecutive_failures", failures)
 
-    var timer *time.Timer
-    if err == nil && successful {
-        timer = time.NewTimer(s.config.UpdateInterval)
+    for {
+        reloaded := s.reloadSignal()
+        timer := time.NewTimer(delay - time.Since(start))
+        select {
+        case <-ctx.Done():
+            timer.Stop()
+            return ctx.Err()
+        case <-timer.C:
+            return nil
+        case <-reloaded:
+            timer.Stop()
+            delay = s.nextDelay(failures)
+            slog.Debug("Rescheduling next update after reload", "delay", delay.String(), "consecutive_failures", failures)
+        }
     }
+}
+
+// runPurge deletes expired proxies on every purge interval until ctx is done
+func (s *ProxyService) runPurge(ctx context.Context) {
+    purgeInterval := func(cfg *config.Config) time.Duration { return cfg.PurgeInterval }
+    s.runPeriodically(ctx, "purge", purgeInterval, func(ctx context.Context) {
+        purged, err := s.storage.PurgeExpired(ctx, time.Now())
+        if err != nil {
+            slog.Error("Failed to purge expired proxies", "error", err)
+            return
+        }
+        slog.Info("Purged expired proxies", "purged", purged)
+    })
+}
+
+// runPoolMetrics recounts the pool gauges on startup and then on every pool
+// metrics interval until ctx is done. The count scans the whole table, so it
+// runs on its own interval rather than after every cycle.
+func (s *ProxyService) runPoolMetrics(ctx context.Context) {
+    poolMetricsInterval := func(cfg *config.Config) time.Duration { return cfg.PoolMetricsInterval }
+    if poolMetricsInterval(s.cfg()) > 0 {
+        s.track("pool recount", s.recordPoolSize)
+    }
+    s.runPeriodically(ctx, "pool recount", poolMetricsInterval, s.recordPoolSize)
+}
+
+// recordPoolSize counts the healthy stored proxies by country and protocol
+// for the pool gauges
+func (s *ProxyService) recordPoolSize(ctx context.Context) {
+    sizes := make(map[metrics.PoolKey]int)
+    var healthy, stored int
+    now := time.Now()
+    startKey := ""
 
     for {
-        if timer == nil {
-            select {
-            case <-ctx.Done():
-                log.Println("Proxy service stopping...")
-                return ctx.Err()
+        page, nextKey, err := s.storage.ScanProxies(ctx, startKey, 0)
+        if err != nil {
+            slog.Warn("Failed to count stored proxies for metrics", "error", err)
+            return
+        }
+
+        for _, proxy := range page {
+            stored++
+            protocols := proxy.EffectiveProtocols()
+            if len(protocols) == 0 || proxy.Expired(now) {
+                continue
             }
-        } else {
-            select {
-            case <-ctx.Done():
-                log.Println("Proxy service stopping...")
-                timer.Stop()
-                return ctx.Err()
-            case <-timer.C:
-                successful, err := s.updateProxies()
-                if err != nil {
-                    log.Printf("Failed to update proxies: %v", err)
-                } else if successful {
-                    log.Printf("Update successful, scheduling next in 1 minute")
-                    timer.Reset(s.config.UpdateInterval)
-                } else {
-                    log.Println("Update had no changes, not scheduling next")
-                    timer.Stop()
-                    timer = nil
-                }
+            healthy++
+            for _, protocol := range protocols {
+                sizes[metrics.PoolKey{Country: proxy.Country, Protocol: protocol}]++
             }
         }
+
+        if nextKey == "" {
+            break
+        }
+        startKey = nextKey
     }
+
+    metrics.SetPoolSize(sizes, healthy, stored)
 }
 
-func (s *ProxyService) updateProxies() (bool, error) {
-    log.Printf("Fetching proxies from API (limit: %d)...", s.config.ProxyLimit)
+// nextDelay returns how long to wait before the next cycle. The update
+// interval doubles with every consecutive failure up to the max backoff,
+// and a random jitter is added either way so instances do not align.
+func (s *ProxyService) nextDelay(failures int) time.Duration {
+    delay := s.cfg().UpdateInterval
+    // A failure never makes the next cycle come sooner than a success would
+    maxBackoff := s.cfg().UpdateMaxBackoff
+    if maxBackoff < delay {
+        maxBackoff = delay
+    }
+    for i := 0; i < failures && delay < maxBackoff; i++ {
+        delay *= 2
+    }
+    if failures > 0 && delay > maxBackoff {
+        delay = maxBackoff
+    }
 
-    var proxies []models.ProxyData
-    var err error
-    maxRetries := 3
-    retryDelay := 3 * time.Second
+    if jitter := s.cfg().UpdateJitter; jitter > 0 {
+        delay += time.Duration(rand.Int63n(int64(2*jitter))) - jitter
+    }
+    if delay < time.Second {
+        delay = time.Second
+    }
 
-    for attempt := 1; attempt <= maxRetries; attempt++ {
-        proxies, err = s.client.FetchProxies(s.config.ProxyLimit)
-        if err == nil {
-            break
-        }
+    return delay
+}
 
-        if attempt < maxRetries {
-            log.Printf("Failed to fetch proxies (attempt %d/%d): %v. Retrying in %v...",
-                attempt, maxRetries, err, retryDelay)
-            time.Sleep(retryDelay)
-        } else {
-            log.Printf("Failed to fetch proxies after %d attempts: %v", maxRetries, err)
-            return false, err
-        }
+// newCycleID returns a short random ID that ties together the log lines of
+// one update or revalidation run
+func newCycleID() string {
+    return fmt.Sprintf("%08x", rand.Uint32())
+}
+
+// cycleSummary is what one update cycle did, logged as a single record when
+// the cycle ends
+type cycleSummary struct {
+    fetched          int
+    validated        int
+    demoted          int
+    skipped          int
+    abandoned        int
+    newProxies       int
+    updatedProxies   int
+    passedByProtocol map[string]int
+}
+
+func (c cycleSummary) log(logger *slog.Logger, duration time.Duration, err error) {
+    args := []interface{}{
+        "fetched", c.fetched,
+        "validated", c.validated,
+        "demoted", c.demoted,
+        "skipped", c.skipped,
+        "abandoned", c.abandoned,
+        "new", c.newProxies,
+        "updated", c.updatedProxies,
+        "passed_by_protocol", c.passedByProtocol,
+        "duration_ms", duration.Milliseconds(),
+    }
+    if err != nil {
+        logger.Error("Update cycle failed", append(args, "error", err)...)
+        return
+    }
+    logger.Info("Update cycle finished", args...)
+}
+
+func (s *ProxyService) updateProxies(ctx context.Context) (changed bool, err error) {
+    logger := slog.With("cycle", newCycleID())
+    start := time.Now()
+    summary := cycleSummary{passedByProtocol: make(map[string]int)}
+    defer func() {
+        summary.log(logger, time.Since(start), err)
+    }()
+
+    proxies, err := s.fetchAll(ctx, logger)
+    if err != nil {
+        return false, err
     }
+    summary.fetched = len(proxies)
 
-    log.Printf("Fetched %d proxies from API", len(proxies))
+    logger.Debug("Fetched unique proxies", "proxies", len(proxies))
 
     // Check which proxies need updates
     var toUpdate []models.ProxyData
-    var newProxies, updatedProxies int
 
     // Collect all proxy keys
     proxyKeys := make([]string, len(proxies))
@@ -121,142 +299,267 @@ func (s *ProxyService) updateProxies() (bool, error) {
     }
 
     // Batch get existing proxies
-    existingProxies, err := s.storage.BatchGetProxies(proxyKeys)
+    existingProxies, err := s.storage.BatchGetProxies(ctx, proxyKeys)
     if err != nil {
         return false, fmt.Errorf("failed to batch get proxies: %v", err)
     }
 
     // Validate proxies concurrently
     type validationResult struct {
-        proxy   models.ProxyData
-        valid   bool
-        index   int
+        proxy     models.ProxyData
+        valid     bool
+        checked   bool     // Whether any protocol could be tested
+        abandoned bool     // Cut short by cancellation, so not a real outcome
+        protocols []string // Protocols that passed validation
+        index     int
     }
 
     validationChan := make(chan validationResult, len(proxies))
-    semaphore := make(chan struct{}, 500) // Limit to 10 concurrent validations
+    semaphore := make(chan struct{}, s.cfg().ValidationConcurrency)
 
     for i, proxy := range proxies {
         go func(p models.ProxyData, idx int) {
-            semaphore <- struct{}{} // Acquire
+            select {
+            case semaphore <- struct{}{}: // Acquire
+            case <-ctx.Done():
+                validationChan <- validationResult{proxy: p, abandoned: true, index: idx}
+                return
+            }
             defer func() { <-semaphore }() // Release
 
-            valid := s.validateProxy(&p)
-            validationChan <- validationResult{proxy: p, valid: valid, index: idx}
+            report := s.validateProxy(ctx, logger, &p)
+            if ctx.Err() != nil {
+                validationChan <- validationResult{proxy: p, abandoned: true, index: idx}
+                return
+            }
+            report.Apply(&p, time.Now())
+            passed := report.Passed()
+            valid := !report.Checked() || len(passed) > 0
+            validationChan <- validationResult{proxy: p, valid: valid, checked: report.Checked(), protocols: passed, index: idx}
         }(proxy, i)
     }
 
     // Collect validation results
     validatedProxies := make([]models.ProxyData, 0, len(proxies))
+    var demotedProxies []models.ProxyData
     for i := 0; i < len(proxies); i++ {
         result := <-validationChan
+        if result.abandoned {
+            summary.abandoned++
+            continue
+        }
+        for _, protocol := range result.protocols {
+            summary.passedByProtocol[protocol]++
+        }
+
+        existingProxy := existingProxies[result.proxy.GetKey()]
+        var since time.Time
+        if existingProxy != nil {
+            carryOwnState(existingProxy, &result.proxy)
+            since = existingProxy.ValidatedAt
+        }
+        if result.checked {
+            result.proxy.UpdateHealth(since, len(result.protocols) > 0, result.proxy.ValidatedAt, s.cfg().HealthHalfLife)
+        }
+
         if result.valid {
             validatedProxies = append(validatedProxies, result.proxy)
+        } else if existingProxy != nil {
+            // Stored proxies keep their failures so their score drops
+            demotedProxies = append(demotedProxies, result.proxy)
         } else {
-            log.Printf("Skipping invalid proxy: %s", result.proxy.GetKey())
+            summary.skipped++
+            logger.Debug("Skipping invalid proxy", "proxy", result.proxy.GetKey())
         }
     }
+    summary.validated = len(validatedProxies)
+    summary.demoted = len(demotedProxies)
+
+    // Nothing is written from a cancelled cycle, the next one starts over
+    if err := ctx.Err(); err != nil {
+        return false, fmt.Errorf("cancelled with %d validations abandoned, nothing written: %v", summary.abandoned, err)
+    }
 
-    // Process validated proxies
-    for _, proxy := range validatedProxies {
+    // Process validated proxies, and failed ones we already store
+    for _, proxy := range append(validatedProxies, demotedProxies...) {
         proxyKey := proxy.GetKey()
 
         existingProxy := existingProxies[proxyKey]
         if existingProxy == nil {
             // New proxy
+            if proxy.CreatedAt.IsZero() {
+                proxy.CreatedAt = time.Now()
+            }
             toUpdate = append(toUpdate, proxy)
-            newProxies++
+            summary.newProxies++
         } else if s.hasProxyChanged(existingProxy, &proxy) {
             // Proxy has changed
             toUpdate = append(toUpdate, proxy)
-            updatedProxies++
+            summary.updatedProxies++
         }
     }
 
     if len(toUpdate) > 0 {
-        log.Printf("Updating %d proxies (%d new, %d updated)", len(toUpdate), newProxies, updatedProxies)
-
-        if err := s.storage.BatchUpsertProxies(toUpdate); err != nil {
+        if err := s.storage.BatchUpsertProxies(ctx, toUpdate); err != nil {
             return false, err
         }
-
-        log.Printf("Successfully updated %d proxies", len(toUpdate))
         return true, nil
-    } else {
-        log.Println("No proxy updates needed")
-        return false, nil
     }
+    return false, nil
 }
 
-func (s *ProxyService) validateProxy(p *models.ProxyData) bool {
-    // Only validate SOCKS4 and SOCKS5 proxies
-    hasSocks := false
-    for _, protocol := range p.Protocols {
-        if protocol == "socks4" || protocol == "socks5" {
-            hasSocks = true
-            break
+// fetchAll fetches from every configured source and merges the results by
+// proxy key. A failing source is logged and skipped unless all of them fail.
+func (s *ProxyService) fetchAll(ctx context.Context, logger *slog.Logger) ([]models.ProxyData, error) {
+    var merged []models.ProxyData
+    index := make(map[string]int)
+    var failed int
+    var lastErr error
+    sources := s.currentSources()
+
+    for _, source := range sources {
+        if err := ctx.Err(); err != nil {
+            return nil, err
+        }
+
+        proxies, err := s.fetchSource(ctx, logger, source)
+        if err != nil {
+            failed++
+            lastErr = fmt.Errorf("source %s: %v", source.Name(), err)
+            continue
+        }
+
+        logger.Info("Fetched proxies", "source", source.Name(), "proxies", len(proxies))
+
+        for _, p := range proxies {
+            key := p.GetKey()
+            if i, ok := index[key]; ok {
+                merged[i].Protocols = mergeProtocols(merged[i].Protocols, p.Protocols)
+                continue
+            }
+            index[key] = len(merged)
+            merged = append(merged, p)
         }
     }
 
-    if !hasSocks {
-        return true // Skip validation for non-SOCKS proxies
+    if failed == len(sources) {
+        return nil, lastErr
     }
 
-    proxyAddr := fmt.Sprintf("%s:%s", p.IP, p.Port)
+    return merged, nil
+}
 
-    for _, protocol := range p.Protocols {
-        if protocol != "socks4" && protocol != "socks5" {
-            continue
-        }
+func (s *ProxyService) fetchSource(ctx context.Context, logger *slog.Logger, source client.ProxySource) ([]models.ProxyData, error) {
+    limit := s.cfg().ProxyLimit
+    if maxLimit := source.Capabilities().MaxLimit; maxLimit > 0 && limit > maxLimit {
+        limit = maxLimit
+    }
 
-        var dialer proxy.Dialer
-        var err error
+    logger.Debug("Fetching proxies", "source", source.Name(), "limit", limit)
 
-        if protocol == "socks5" {
-            dialer, err = proxy.SOCKS5("tcp", proxyAddr, nil, nil)
-        } else if protocol == "socks4" {
-            dialer, err = proxy.SOCKS5("tcp", proxyAddr, nil, nil) // SOCKS4 is handled by SOCKS5 dialer in most cases
-        }
+    var proxies []models.ProxyData
+    var err error
+    maxRetries := s.cfg().FetchRetries
+    retryDelay := s.cfg().FetchRetryDelay
 
-        if err != nil {
-            log.Printf("Failed to create %s dialer for %s: %v", strings.ToUpper(protocol), proxyAddr, err)
-            continue
+    for attempt := 1; attempt <= maxRetries; attempt++ {
+        start := time.Now()
+        proxies, err = source.FetchProxies(ctx, limit)
+        metrics.ObserveFetch(source.Name(), time.Since(start), len(proxies), err)
+        if err == nil {
+            return proxies, nil
         }
-
-        // Create HTTP client with proxy
-        httpClient := &http.Client{
-            Transport: &http.Transport{
-                Dial: dialer.Dial,
-            },
-            Timeout: 10 * time.Second,
+        if ctx.Err() != nil {
+            return nil, err
         }
-
-        // Test with a simple HTTP request
-        testURL := "http://httpbin.org/ip"
-        resp, err := httpClient.Get(testURL)
-        if err != nil {
-            log.Printf("Failed to validate %s proxy %s: %v", strings.ToUpper(protocol), proxyAddr, err)
-            continue
+        if len(proxies) > 0 {
+            // Keep what the source got before failing rather than fetching it all again
+            logger.Warn("Fetched proxies partially", "source", source.Name(), "proxies", len(proxies), "error", err)
+            return proxies, nil
         }
-        resp.Body.Close()
 
-        if resp.StatusCode == 200 {
-            log.Printf("Successfully validated %s proxy %s", strings.ToUpper(protocol), proxyAddr)
-            return true
+        if attempt < maxRetries {
+            logger.Warn("Failed to fetch proxies, retrying", "source", source.Name(),
+                "attempt", attempt, "max_attempts", maxRetries, "retry_in", retryDelay.String(), "error", err)
+            select {
+            case <-time.After(retryDelay):
+            case <-ctx.Done():
+                return nil, ctx.Err()
+            }
         } else {
-            log.Printf("Proxy %s returned status %d", proxyAddr, resp.StatusCode)
+            logger.Error("Failed to fetch proxies", "source", source.Name(), "attempts", maxRetries, "error", err)
+        }
+    }
+
+    return nil, err
+}
+
+// mergeProtocols returns the union of both protocol lists, keeping order
+func mergeProtocols(existing, extra []string) []string {
+    for _, protocol := range extra {
+        found := false
+        for _, p := range existing {
+            if p == protocol {
+                found = true
+                break
+            }
+        }
+        if !found {
+            existing = append(existing, protocol)
         }
     }
+    return existing
+}
 
-    return false
+// carryOwnState copies the fields we maintain across cycles from the stored
+// proxy onto the freshly fetched one. Upserts replace everything but the
+// lease, so anything not carried over is lost.
+func carryOwnState(existing, new *models.ProxyData) {
+    if new.CreatedAt.IsZero() {
+        new.CreatedAt = existing.CreatedAt
+    }
+    new.HealthScore = existing.HealthScore
+    new.HealthSuccesses = existing.HealthSuccesses
+    new.HealthFailures = existing.HealthFailures
+    new.LastSuccessAt = existing.LastSuccessAt
 }
 
 func (s *ProxyService) hasProxyChanged(existing, new *models.ProxyData) bool {
-    return existing.LastChecked != new.LastChecked ||
+    return !existing.LastChecked.Equal(new.LastChecked) ||
             existing.ResponseTime != new.ResponseTime ||
             existing.UpTime != new.UpTime ||
             existing.UpTimeSuccessCount != new.UpTimeSuccessCount ||
             existing.Speed != new.Speed ||
             existing.Anonymity != new.Anonymity ||
-            len(existing.Protocols) != len(new.Protocols)
-}
\ No newline at end of file
+            len(existing.Protocols) != len(new.Protocols) ||
+            s.hasValidationChanged(existing, new)
+}
+
+// hasValidationChanged reports whether our own measurements moved enough to
+// be worth a write. Stored results are also refreshed once they get old so
+// validated_at stays meaningful.
+func (s *ProxyService) hasValidationChanged(existing, new *models.ProxyData) bool {
+    if new.ValidatedAt.IsZero() {
+        return false
+    }
+    if new.ValidatedAt.Sub(existing.ValidatedAt) > validationRefreshInterval {
+        return true
+    }
+    if strings.Join(existing.ValidProtocols, ",") != strings.Join(new.ValidProtocols, ",") ||
+        existing.ValidationError != new.ValidationError ||
+        existing.MeasuredAnonymity != new.MeasuredAnonymity {
+        return true
+    }
+    if math.Abs(existing.HealthScore-new.HealthScore) > healthScoreTolerance {
+        return true
+    }
+    return latencyChanged(existing.FirstByteLatencyMs, new.FirstByteLatencyMs)
+}
+
+// latencyChanged reports whether two latencies differ by more than a quarter
+func latencyChanged(old, new float64) bool {
+    if old == 0 {
+        return new != 0
+    }
+    return math.Abs(new-old)/old > 0.25
+}
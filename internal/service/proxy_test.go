@@ -0,0 +1,231 @@
+package service
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "log/slog"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "proxy-system/internal/client"
+    "proxy-system/internal/config"
+    "proxy-system/internal/judge"
+    "proxy-system/internal/models"
+    "proxy-system/internal/storage"
+)
+
+// fixedSource is a ProxySource that always returns the same proxies
+type fixedSource struct {
+    proxies []models.ProxyData
+}
+
+func (s *fixedSource) Name() string { return "fixed" }
+
+func (s *fixedSource) FetchProxies(ctx context.Context, limit int) ([]models.ProxyData, error) {
+    return s.proxies, nil
+}
+
+func (s *fixedSource) Capabilities() client.Capabilities {
+    return client.Capabilities{Protocols: []string{"http"}}
+}
+
+func TestNewProxyServiceIgnoresLoopbackOrigin(t *testing.T) {
+    judgeServer := httptest.NewServer(judge.Handler())
+    defer judgeServer.Close()
+
+    sources := []client.ProxySource{&fixedSource{}}
+    store := storage.NewMemoryStorage(time.Hour)
+
+    cfg := &config.Config{JudgeURL: judgeServer.URL, ValidationTimeout: 5 * time.Second}
+    if _, err := NewProxyService(cfg, sources, store); err == nil {
+        t.Fatal("NewProxyService with a local judge and no JUDGE_ORIGIN_IPS succeeded, want an error")
+    }
+
+    cfg.JudgeOriginIPs = []string{"203.0.113.7"}
+    s, err := NewProxyService(cfg, sources, store)
+    if err != nil {
+        t.Fatalf("NewProxyService with JUDGE_ORIGIN_IPS: %v", err)
+    }
+    if len(s.originIPs) != 1 || s.originIPs[0] != "203.0.113.7" {
+        t.Errorf("originIPs = %v, want only the configured address", s.originIPs)
+    }
+}
+
+// forwardingProxy is a minimal HTTP forward proxy standing in for a working
+// proxy from a source
+func forwardingProxy(t *testing.T) *httptest.Server {
+    t.Helper()
+
+    transport := &http.Transport{}
+    t.Cleanup(transport.CloseIdleConnections)
+
+    proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        out, err := http.NewRequestWithContext(r.Context(), r.Method, r.URL.String(), r.Body)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        out.Header = r.Header.Clone()
+
+        resp, err := transport.RoundTrip(out)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadGateway)
+            return
+        }
+        defer resp.Body.Close()
+
+        w.WriteHeader(resp.StatusCode)
+        io.Copy(w, resp.Body)
+    }))
+    t.Cleanup(proxy.Close)
+
+    return proxy
+}
+
+// deadPort returns a local port nothing is listening on
+func deadPort(t *testing.T) string {
+    t.Helper()
+
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer listener.Close()
+    return fmt.Sprint(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestUpdateProxiesWithMemoryStorage(t *testing.T) {
+    target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        io.WriteString(w, "ok")
+    }))
+    defer target.Close()
+
+    cfg, err := config.Load([]string{
+        "-storage-backend", config.StorageMemory,
+        "-proxy-lists", "http=http://lists.invalid/http.txt",
+        "-validation-urls", target.URL,
+        "-validation-expected-body", "ok",
+        "-validation-timeout", "5s",
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    working := models.ProxyData{IP: "127.0.0.1", Port: fmt.Sprint(forwardingProxy(t).Listener.Addr().(*net.TCPAddr).Port), Protocols: []string{"http"}}
+    port := deadPort(t)
+    deadNew := models.ProxyData{IP: "127.0.0.1", Port: port, Protocols: []string{"http"}}
+    deadStored := models.ProxyData{IP: "127.0.0.2", Port: port, Protocols: []string{"http"}}
+
+    // A proxy that worked in an earlier cycle and has stopped working since
+    createdAt := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+    stored := deadStored
+    stored.CreatedAt = createdAt
+    stored.ValidatedAt = time.Now().Add(-time.Hour)
+    stored.ValidProtocols = []string{"http"}
+
+    store := storage.NewMemoryStorage(cfg.ProxyTTL)
+    if err := store.UpsertProxy(context.Background(), &stored); err != nil {
+        t.Fatal(err)
+    }
+
+    source := &fixedSource{proxies: []models.ProxyData{working, deadNew, deadStored}}
+    s, err := NewProxyService(cfg, []client.ProxySource{source}, store)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    changed, err := s.updateProxies(context.Background())
+    if err != nil {
+        t.Fatalf("updateProxies: %v", err)
+    }
+    if !changed {
+        t.Error("updateProxies reported no change, want the new and demoted proxies written")
+    }
+
+    got, err := store.BatchGetProxies(context.Background(), []string{working.GetKey(), deadNew.GetKey(), deadStored.GetKey()})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if p := got[working.GetKey()]; p == nil {
+        t.Error("working proxy was not stored")
+    } else {
+        if len(p.ValidProtocols) != 1 || p.ValidProtocols[0] != "http" {
+            t.Errorf("working proxy ValidProtocols = %v, want [http]", p.ValidProtocols)
+        }
+        if p.ValidatedAt.IsZero() || p.CreatedAt.IsZero() {
+            t.Errorf("working proxy ValidatedAt = %v, CreatedAt = %v, want both set", p.ValidatedAt, p.CreatedAt)
+        }
+    }
+
+    if p := got[deadNew.GetKey()]; p != nil {
+        t.Errorf("new proxy that failed validation was stored: %+v", p)
+    }
+
+    if p := got[deadStored.GetKey()]; p == nil {
+        t.Error("stored proxy that failed validation was removed, want it kept with its failure")
+    } else {
+        if len(p.ValidProtocols) != 0 || p.ValidationError == "" {
+            t.Errorf("demoted proxy ValidProtocols = %v, ValidationError = %q, want none and an error", p.ValidProtocols, p.ValidationError)
+        }
+        if !p.CreatedAt.Equal(createdAt) {
+            t.Errorf("demoted proxy CreatedAt = %v, want the stored %v", p.CreatedAt, createdAt)
+        }
+    }
+}
+
+// partialSource fails partway through every fetch, after returning some proxies
+type partialSource struct {
+    fixedSource
+    calls int
+}
+
+func (s *partialSource) FetchProxies(ctx context.Context, limit int) ([]models.ProxyData, error) {
+    s.calls++
+    return s.proxies, fmt.Errorf("page 2: upstream unavailable")
+}
+
+func TestFetchSourceKeepsPartialResults(t *testing.T) {
+    source := &partialSource{fixedSource: fixedSource{proxies: []models.ProxyData{{IP: "10.0.0.1", Port: "8080"}}}}
+    cfg := &config.Config{FetchRetries: 3}
+    s, err := NewProxyService(cfg, []client.ProxySource{source}, storage.NewMemoryStorage(0))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    proxies, err := s.fetchSource(context.Background(), slog.Default(), source)
+    if err != nil {
+        t.Fatalf("fetchSource: %v", err)
+    }
+    if len(proxies) != 1 || source.calls != 1 {
+        t.Errorf("got %d proxies after %d fetches, want the partial result from a single fetch", len(proxies), source.calls)
+    }
+}
+
+func TestNextDelayBacksOff(t *testing.T) {
+    tests := []struct {
+        name       string
+        interval   time.Duration
+        maxBackoff time.Duration
+        failures   int
+        want       time.Duration
+    }{
+        {"success", 5 * time.Minute, 15 * time.Minute, 0, 5 * time.Minute},
+        {"one failure doubles", 5 * time.Minute, 15 * time.Minute, 1, 10 * time.Minute},
+        {"capped at max backoff", 5 * time.Minute, 15 * time.Minute, 3, 15 * time.Minute},
+        {"max backoff below interval", 10 * time.Minute, time.Minute, 2, 10 * time.Minute},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            s := &ProxyService{config: &config.Config{UpdateInterval: tt.interval, UpdateMaxBackoff: tt.maxBackoff}}
+            if got := s.nextDelay(tt.failures); got != tt.want {
+                t.Errorf("nextDelay(%d) = %v, want %v", tt.failures, got, tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+    "context"
+    "fmt"
+    "time"
+
+    "proxy-system/internal/client"
+    "proxy-system/internal/config"
+)
+
+// Reload switches the service to a new config and set of sources without
+// stopping it. Work already running picks up the new settings the next time
+// it reads them, and waits for the next update, purge or revalidation are
+// rescheduled from the new intervals.
+func (s *ProxyService) Reload(cfg *config.Config, sources []client.ProxySource) error {
+    if len(sources) == 0 {
+        return fmt.Errorf("no proxy sources configured")
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.config = cfg
+    s.sources = sources
+    close(s.reloaded)
+    s.reloaded = make(chan struct{})
+    return nil
+}
+
+// cfg returns the config currently in effect
+func (s *ProxyService) cfg() *config.Config {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    return s.config
+}
+
+// currentSources returns the proxy sources currently in effect
+func (s *ProxyService) currentSources() []client.ProxySource {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    return s.sources
+}
+
+// reloadSignal returns a channel that is closed by the next reload
+func (s *ProxyService) reloadSignal() <-chan struct{} {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    return s.reloaded
+}
+
+// runPeriodically calls run every interval, as read from the current config,
+// until ctx is done. Each run is tracked under name for Shutdown to wait on.
+// A reload that changes the interval restarts the wait, and a zero interval
+// pauses run until a reload sets one.
+func (s *ProxyService) runPeriodically(ctx context.Context, name string, interval func(*config.Config) time.Duration, run func(ctx context.Context)) {
+    for {
+        reloaded := s.reloadSignal()
+        every := interval(s.cfg())
+
+        var ticker *time.Ticker
+        var tick <-chan time.Time
+        if every > 0 {
+            ticker = time.NewTicker(every)
+            tick = ticker.C
+        }
+
+        changed := false
+        for !changed {
+            select {
+            case <-ctx.Done():
+                if ticker != nil {
+                    ticker.Stop()
+                }
+                return
+            case <-tick:
+                if ctx.Err() == nil {
+                    s.track(name, run)
+                }
+            case <-reloaded:
+                reloaded = s.reloadSignal()
+                changed = interval(s.cfg()) != every
+            }
+        }
+
+        if ticker != nil {
+            ticker.Stop()
+        }
+    }
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+    "context"
+    "fmt"
+    "log/slog"
+    "sync"
+    "time"
+
+    "proxy-system/internal/config"
+    "proxy-system/internal/models"
+    "proxy-system/internal/storage"
+)
+
+// runRevalidation rechecks stored proxies on every revalidation interval
+// until ctx is done
+func (s *ProxyService) runRevalidation(ctx context.Context) {
+    revalidateInterval := func(cfg *config.Config) time.Duration { return cfg.RevalidateInterval }
+    s.runPeriodically(ctx, "revalidation", revalidateInterval, func(ctx context.Context) {
+        logger := slog.With("revalidation", newCycleID())
+        start := time.Now()
+        revalidated, demoted, err := s.revalidateStale(ctx, logger)
+        if err != nil {
+            logger.Error("Revalidation failed", "revalidated", revalidated, "demoted", demoted, "error", err)
+            return
+        }
+        logger.Info("Revalidation finished", "revalidated", revalidated, "demoted", demoted,
+            "duration_ms", time.Since(start).Milliseconds())
+    })
+}
+
+// revalidateStale pages through storage and re-tests every proxy whose own
+// validation is older than RevalidateAfter, whether or not a source still
+// lists it. Proxies that fail lose their valid protocols, which takes them
+// out of the gateway and lets them expire. Proxies with no protocol we can
+// test are left alone, as they would never get a validation time. It uses its
+// own concurrency budget so it never starves the fetch cycle. Only the
+// validation results and health are written back, and not at all for proxies
+// the update cycle validated in the meantime.
+func (s *ProxyService) revalidateStale(ctx context.Context, logger *slog.Logger) (int, int, error) {
+    semaphore := make(chan struct{}, s.cfg().RevalidateConcurrency)
+    var revalidated, demoted int
+    startKey := ""
+
+    for {
+        page, nextKey, err := s.storage.ScanProxies(ctx, startKey, s.cfg().RevalidatePageSize)
+        if err != nil {
+            return revalidated, demoted, err
+        }
+
+        cutoff := time.Now().Add(-s.cfg().RevalidateAfter)
+        var mu sync.Mutex
+        var wg sync.WaitGroup
+        var updated []storage.ValidationUpdate
+        var abandoned int
+
+    proxies:
+        for _, proxy := range page {
+            if proxy.ValidatedAt.After(cutoff) || !canValidate(&proxy) {
+                continue
+            }
+
+            select {
+            case semaphore <- struct{}{}:
+            case <-ctx.Done():
+                break proxies
+            }
+
+            wg.Add(1)
+            go func(p models.ProxyData) {
+                defer wg.Done()
+                defer func() { <-semaphore }()
+
+                wasValid := len(p.EffectiveProtocols()) > 0
+                since := p.ValidatedAt
+
+                report := s.validateProxy(ctx, logger, &p)
+
+                mu.Lock()
+                defer mu.Unlock()
+                if ctx.Err() != nil {
+                    // A cancelled check would count as a failure
+                    abandoned++
+                    return
+                }
+                if !report.Checked() {
+                    return
+                }
+                report.Apply(&p, time.Now())
+                p.UpdateHealth(since, len(report.Passed()) > 0, p.ValidatedAt, s.cfg().HealthHalfLife)
+
+                updated = append(updated, storage.ValidationUpdate{Proxy: p, Since: since})
+                if wasValid && len(p.ValidProtocols) == 0 {
+                    demoted++
+                }
+            }(proxy)
+        }
+        wg.Wait()
+
+        if err := ctx.Err(); err != nil {
+            return revalidated, demoted, fmt.Errorf("cancelled with %d validated proxies unwritten and %d validations abandoned: %v",
+                len(updated), abandoned, err)
+        }
+
+        if len(updated) > 0 {
+            written, err := s.storage.RecordValidations(ctx, updated)
+            revalidated += written
+            if err != nil {
+                return revalidated, demoted, err
+            }
+        }
+
+        if nextKey == "" {
+            return revalidated, demoted, nil
+        }
+        startKey = nextKey
+    }
+}
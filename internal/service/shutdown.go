@@ -0,0 +1,82 @@
+package service
+
+import (
+    "context"
+    "fmt"
+    "log/slog"
+    "sort"
+    "strings"
+)
+
+// track runs fn as in-flight work under the given name, passing it the work
+// context that Shutdown cancels once its deadline passes. It returns false
+// without running fn once Shutdown has begun.
+func (s *ProxyService) track(name string, fn func(ctx context.Context)) bool {
+    s.workMu.Lock()
+    if s.draining {
+        s.workMu.Unlock()
+        return false
+    }
+    s.running[name]++
+    s.inFlight.Add(1)
+    s.workMu.Unlock()
+
+    defer func() {
+        s.workMu.Lock()
+        defer s.workMu.Unlock()
+        if s.running[name]--; s.running[name] == 0 {
+            delete(s.running, name)
+        }
+        s.inFlight.Done()
+    }()
+
+    fn(s.work)
+    return true
+}
+
+// runningWork lists the operations in flight
+func (s *ProxyService) runningWork() []string {
+    s.workMu.Lock()
+    defer s.workMu.Unlock()
+    names := make([]string, 0, len(s.running))
+    for name := range s.running {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// Shutdown stops new work from starting and waits for the update cycle, purge
+// and revalidation in flight to finish their validations and writes. If ctx is
+// done first they are cancelled, and once they have returned Shutdown reports
+// which of them were abandoned. Each one logs how far it got.
+func (s *ProxyService) Shutdown(ctx context.Context) error {
+    s.workMu.Lock()
+    s.draining = true
+    s.workMu.Unlock()
+
+    done := make(chan struct{})
+    go func() {
+        s.inFlight.Wait()
+        close(done)
+    }()
+
+    if running := s.runningWork(); len(running) > 0 {
+        slog.Info("Waiting for in-flight work", "running", running)
+    }
+
+    select {
+    case <-done:
+        s.cancelWork()
+        return nil
+    case <-ctx.Done():
+    }
+
+    abandoned := s.runningWork()
+    s.cancelWork()
+    <-done
+    if len(abandoned) == 0 {
+        return nil
+    }
+    return fmt.Errorf("abandoned %s: %v", strings.Join(abandoned, ", "), ctx.Err())
+}
@@ -0,0 +1,277 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "net"
+    "net/http"
+    "net/http/httptrace"
+    "net/url"
+    "strings"
+    "sync/atomic"
+    "time"
+
+    "proxy-system/internal/config"
+    "proxy-system/internal/dialer"
+    "proxy-system/internal/judge"
+    "proxy-system/internal/metrics"
+    "proxy-system/internal/models"
+)
+
+// maxValidationBody caps how much of a response is searched for the expected body
+const maxValidationBody = 1 << 20
+
+// testableProtocols are the protocols validateProxy can test
+var testableProtocols = map[string]bool{"http": true, "https": true, "socks4": true, "socks5": true}
+
+// canValidate reports whether the proxy advertises any protocol we can test
+func canValidate(p *models.ProxyData) bool {
+    for _, protocol := range p.Protocols {
+        if testableProtocols[protocol] {
+            return true
+        }
+    }
+    return false
+}
+
+// protocolResult is the outcome of validating a proxy over one protocol
+type protocolResult struct {
+    Protocol         string
+    Err              error
+    ConnectLatency   time.Duration // Time to reach the proxy and set up the tunnel
+    FirstByteLatency time.Duration // Time from sending the request to the first response byte
+}
+
+// validationReport holds a result for every protocol that was tested
+type validationReport struct {
+    Results   []protocolResult
+    Anonymity string // Level measured through the judge, empty if not checked
+}
+
+// Checked reports whether any protocol could be tested at all
+func (r validationReport) Checked() bool {
+    return len(r.Results) > 0
+}
+
+// Passed returns the protocols that validated successfully
+func (r validationReport) Passed() []string {
+    var passed []string
+    for _, result := range r.Results {
+        if result.Err == nil {
+            passed = append(passed, result.Protocol)
+        }
+    }
+    return passed
+}
+
+// Apply records the report on the proxy. Latencies are the best seen across
+// the protocols that passed, and failures are kept as the validation error.
+func (r validationReport) Apply(p *models.ProxyData, validatedAt time.Time) {
+    if !r.Checked() {
+        return
+    }
+
+    p.ValidatedAt = validatedAt
+    p.ValidProtocols = r.Passed()
+    p.ConnectLatencyMs = 0
+    p.FirstByteLatencyMs = 0
+
+    var failures []string
+    for _, result := range r.Results {
+        if result.Err != nil {
+            failures = append(failures, fmt.Sprintf("%s: %v", result.Protocol, result.Err))
+            continue
+        }
+
+        connectMs := float64(result.ConnectLatency) / float64(time.Millisecond)
+        if p.ConnectLatencyMs == 0 || connectMs < p.ConnectLatencyMs {
+            p.ConnectLatencyMs = connectMs
+        }
+        firstByteMs := float64(result.FirstByteLatency) / float64(time.Millisecond)
+        if p.FirstByteLatencyMs == 0 || firstByteMs < p.FirstByteLatencyMs {
+            p.FirstByteLatencyMs = firstByteMs
+        }
+    }
+    p.ValidationError = strings.Join(failures, "; ")
+
+    if r.Anonymity != "" {
+        p.MeasuredAnonymity = r.Anonymity
+    }
+}
+
+// validateProxy tests every protocol the proxy advertises and reports the
+// outcome of each one. Once ctx is done the protocols left are not tested,
+// and callers should drop the report.
+func (s *ProxyService) validateProxy(ctx context.Context, logger *slog.Logger, p *models.ProxyData) validationReport {
+    proxyAddr := fmt.Sprintf("%s:%s", p.IP, p.Port)
+    var report validationReport
+
+    for _, protocol := range p.Protocols {
+        if !testableProtocols[protocol] {
+            continue
+        }
+        if ctx.Err() != nil {
+            return report
+        }
+
+        result := s.checkProtocol(ctx, protocol, proxyAddr)
+        metrics.ObserveValidation(protocol, result.Err == nil, result.FirstByteLatency)
+        if result.Err != nil {
+            logger.Debug("Proxy failed validation", "proxy", proxyAddr, "protocol", protocol, "error", result.Err)
+        } else {
+            logger.Debug("Proxy passed validation", "proxy", proxyAddr, "protocol", protocol,
+                "connect_ms", result.ConnectLatency.Milliseconds(), "first_byte_ms", result.FirstByteLatency.Milliseconds())
+        }
+
+        report.Results = append(report.Results, result)
+    }
+
+    // The anonymity level does not depend on the protocol, one passing tunnel is enough
+    if passed := report.Passed(); len(passed) > 0 && s.cfg().JudgeURL != "" {
+        anonymity, err := s.checkAnonymity(ctx, passed[0], proxyAddr)
+        if err != nil {
+            logger.Debug("Failed to check anonymity", "proxy", proxyAddr, "error", err)
+        } else {
+            report.Anonymity = anonymity
+        }
+    }
+
+    return report
+}
+
+// checkProtocol requests the configured validation targets through the proxy
+// using a single protocol. Plain http proxies get absolute-URI requests, every
+// other protocol is used as a tunnel. Latencies are the best seen across the
+// targets that passed.
+func (s *ProxyService) checkProtocol(ctx context.Context, protocol, proxyAddr string) protocolResult {
+    result := protocolResult{Protocol: protocol}
+
+    httpClient, connectLatency, err := s.newProxyClient(protocol, proxyAddr)
+    if err != nil {
+        result.Err = err
+        return result
+    }
+
+    // Keep-alives are off, so every target gets its own connection and timing
+    var passed int
+    var failures []string
+    for _, target := range s.cfg().ValidationTargets {
+        firstByte, err := checkTarget(ctx, httpClient, target)
+        if err != nil {
+            failures = append(failures, fmt.Sprintf("%s: %v", target.URL, err))
+            continue
+        }
+
+        connect := connectLatency()
+        if passed == 0 || connect < result.ConnectLatency {
+            result.ConnectLatency = connect
+        }
+        if passed == 0 || firstByte < result.FirstByteLatency {
+            result.FirstByteLatency = firstByte
+        }
+        passed++
+    }
+
+    if len(failures) > 0 && (s.cfg().ValidationMode == config.ValidationModeAll || passed == 0) {
+        result.Err = errors.New(strings.Join(failures, "; "))
+    }
+
+    return result
+}
+
+// newProxyClient returns an HTTP client that sends every request through the
+// proxy using the given protocol, along with a function reporting how long
+// the most recent dial took. Keep-alives are off so each request dials anew.
+func (s *ProxyService) newProxyClient(protocol, proxyAddr string) (*http.Client, func() time.Duration, error) {
+    var dial func(ctx context.Context, network, addr string) (net.Conn, error)
+    transport := &http.Transport{
+        DisableKeepAlives: true,
+    }
+
+    if protocol == "http" {
+        transport.Proxy = http.ProxyURL(&url.URL{Scheme: "http", Host: proxyAddr})
+        dial = (&net.Dialer{}).DialContext
+    } else {
+        d, err := dialer.ForProtocol(protocol, proxyAddr)
+        if err != nil {
+            return nil, nil, fmt.Errorf("failed to create dialer: %v", err)
+        }
+        dial = d.DialContext
+    }
+
+    // Time the dial, which includes the tunnel handshake for tunnelled protocols.
+    // A timed out request may still be running, hence the atomic.
+    var connectLatency atomic.Int64
+    transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+        start := time.Now()
+        conn, err := dial(ctx, network, addr)
+        connectLatency.Store(int64(time.Since(start)))
+        return conn, err
+    }
+
+    httpClient := &http.Client{
+        Transport: transport,
+        Timeout:   s.cfg().ValidationTimeout,
+    }
+
+    return httpClient, func() time.Duration { return time.Duration(connectLatency.Load()) }, nil
+}
+
+// checkAnonymity sends a request to the judge through the proxy and classifies
+// the proxy from what arrived
+func (s *ProxyService) checkAnonymity(ctx context.Context, protocol, proxyAddr string) (string, error) {
+    httpClient, _, err := s.newProxyClient(protocol, proxyAddr)
+    if err != nil {
+        return "", err
+    }
+
+    report, err := judge.Fetch(ctx, httpClient, s.cfg().JudgeURL)
+    if err != nil {
+        return "", err
+    }
+
+    return judge.Classify(report, s.originIPs), nil
+}
+
+// checkTarget requests the target through the client and checks the response
+// against the expected status codes and body. It returns the time to the
+// first response byte.
+func checkTarget(ctx context.Context, httpClient *http.Client, target config.ValidationTarget) (time.Duration, error) {
+    req, err := http.NewRequestWithContext(ctx, "GET", target.URL, nil)
+    if err != nil {
+        return 0, err
+    }
+
+    var firstByteLatency atomic.Int64
+    start := time.Now()
+    req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+        GotFirstResponseByte: func() {
+            firstByteLatency.Store(int64(time.Since(start)))
+        },
+    }))
+
+    resp, err := httpClient.Do(req)
+    if err != nil {
+        return 0, err
+    }
+    defer resp.Body.Close()
+
+    if !target.ExpectsStatus(resp.StatusCode) {
+        return 0, fmt.Errorf("returned status %d", resp.StatusCode)
+    }
+
+    if target.ExpectedBody != "" {
+        body, err := io.ReadAll(io.LimitReader(resp.Body, maxValidationBody))
+        if err != nil {
+            return 0, fmt.Errorf("failed to read body: %v", err)
+        }
+        if !strings.Contains(string(body), target.ExpectedBody) {
+            return 0, fmt.Errorf("body does not contain %q", target.ExpectedBody)
+        }
+    }
+
+    return time.Duration(firstByteLatency.Load()), nil
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+    "crypto/tls"
+    "crypto/x509"
+    "fmt"
+    "log/slog"
+    "net/http"
+    "os"
+    "time"
+
+    "github.com/aws/aws-sdk-go/aws"
+    "github.com/aws/aws-sdk-go/aws/credentials"
+    "github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+    "github.com/aws/aws-sdk-go/aws/session"
+
+    "proxy-system/internal/config"
+)
+
+// assumedRoleExpiryWindow refreshes assumed role credentials this long
+// before they expire
+const assumedRoleExpiryWindow = time.Minute
+
+// newAWSSession creates a session using the static keys from the config if
+// there are any, and otherwise the SDK's default credential chain:
+// environment, shared config profile, web identity, then the ECS task role or
+// EC2 instance role. The role in the config, if any, is assumed on top.
+func newAWSSession(cfg *config.Config) (*session.Session, error) {
+    options := session.Options{
+        Config:            aws.Config{Region: aws.String(cfg.AWSRegion)},
+        Profile:           cfg.AWSProfile,
+        SharedConfigState: session.SharedConfigEnable,
+    }
+    if cfg.AWSAccessKeyID != "" {
+        options.Config.Credentials = credentials.NewStaticCredentials(
+            cfg.AWSAccessKeyID,
+            cfg.AWSSecretAccessKey,
+            cfg.AWSSessionToken,
+        )
+    }
+
+    sess, err := session.NewSessionWithOptions(options)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create AWS session: %v", err)
+    }
+
+    if cfg.AWSAssumeRoleARN != "" {
+        creds := stscreds.NewCredentials(sess, cfg.AWSAssumeRoleARN, func(p *stscreds.AssumeRoleProvider) {
+            p.RoleSessionName = cfg.AWSAssumeRoleSessionName
+            p.Duration = cfg.AWSAssumeRoleDuration
+            p.ExpiryWindow = assumedRoleExpiryWindow
+            if cfg.AWSAssumeRoleExternalID != "" {
+                p.ExternalID = aws.String(cfg.AWSAssumeRoleExternalID)
+            }
+        })
+        sess = sess.Copy(&aws.Config{Credentials: creds})
+    }
+
+    // Resolve the credentials now so a broken chain fails on startup
+    value, err := sess.Config.Credentials.Get()
+    if err != nil {
+        return nil, fmt.Errorf("failed to get AWS credentials: %v", err)
+    }
+    slog.Info("Using AWS credentials", "provider", value.ProviderName, "region", aws.StringValue(sess.Config.Region),
+        "assumed_role", cfg.AWSAssumeRoleARN)
+
+    return sess, nil
+}
+
+// dynamoDBClientConfig points the DynamoDB client at the endpoint in the
+// config, if any, with its TLS settings. Requests are still signed for the
+// configured region, which DynamoDB Local uses to keep tables apart unless
+// it runs with -sharedDb.
+func dynamoDBClientConfig(cfg *config.Config) (*aws.Config, error) {
+    clientConfig := &aws.Config{}
+    if cfg.DynamoDBEndpoint == "" {
+        return clientConfig, nil
+    }
+    clientConfig.Endpoint = aws.String(cfg.DynamoDBEndpoint)
+
+    if cfg.DynamoDBCAFile != "" || cfg.DynamoDBInsecureSkipVerify {
+        tlsConfig := &tls.Config{InsecureSkipVerify: cfg.DynamoDBInsecureSkipVerify}
+        if cfg.DynamoDBCAFile != "" {
+            pem, err := os.ReadFile(cfg.DynamoDBCAFile)
+            if err != nil {
+                return nil, fmt.Errorf("failed to read DynamoDB CA file: %v", err)
+            }
+            tlsConfig.RootCAs = x509.NewCertPool()
+            if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+                return nil, fmt.Errorf("no certificates found in DynamoDB CA file %s", cfg.DynamoDBCAFile)
+            }
+        }
+
+        transport := http.DefaultTransport.(*http.Transport).Clone()
+        transport.TLSClientConfig = tlsConfig
+        clientConfig.HTTPClient = &http.Client{Transport: transport}
+    }
+
+    slog.Info("Using custom DynamoDB endpoint", "endpoint", cfg.DynamoDBEndpoint, "region", cfg.AWSRegion)
+    return clientConfig, nil
+}
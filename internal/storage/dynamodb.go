@@ -1,42 +1,106 @@
 package storage
 
 import (
+    "context"
     "fmt"
-    "log"
+    "log/slog"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
     "time"
 
     "github.com/aws/aws-sdk-go/aws"
-    "github.com/aws/aws-sdk-go/aws/credentials"
-    "github.com/aws/aws-sdk-go/aws/session"
     "github.com/aws/aws-sdk-go/service/dynamodb"
     "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+    "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 
     "proxy-system/internal/config"
+    "proxy-system/internal/metrics"
     "proxy-system/internal/models"
 )
 
+// Resubmissions of unprocessed batch entries and failed writes
+const maxBatchRetries = 5
+
+// Variables so tests can shorten the backoff
+var (
+    batchRetryBaseDelay = 100 * time.Millisecond // Doubled on every resubmission
+    batchRetryMaxDelay  = 5 * time.Second
+)
+
+// UnprocessedError is returned when DynamoDB still reports unprocessed
+// entries, or keeps failing writes, after every retry. Keys lists the proxy
+// keys that never made it; everything else in the call went through.
+type UnprocessedError struct {
+    Operation string
+    Keys      []string
+    Err       error // Last error seen for them, nil if they were only reported unprocessed
+}
+
+func (e *UnprocessedError) Error() string {
+    msg := fmt.Sprintf("%s left %d keys unprocessed after %d retries: %s",
+        e.Operation, len(e.Keys), maxBatchRetries, strings.Join(e.Keys, ", "))
+    if e.Err != nil {
+        msg += fmt.Sprintf(" (last error: %v)", e.Err)
+    }
+    return msg
+}
+
+func (e *UnprocessedError) Unwrap() error {
+    return e.Err
+}
+
+// batchRetryDelay returns the exponential backoff before the given attempt
+func batchRetryDelay(attempt int) time.Duration {
+    delay := batchRetryBaseDelay << uint(attempt-1)
+    if delay > batchRetryMaxDelay || delay <= 0 {
+        delay = batchRetryMaxDelay
+    }
+    return delay
+}
+
+// sleepContext waits for d, or returns early with the context's error once
+// ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+    timer := time.NewTimer(d)
+    defer timer.Stop()
+
+    select {
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-timer.C:
+        return nil
+    }
+}
+
 type DynamoDBStorage struct {
-    client    *dynamodb.DynamoDB
+    client    dynamodbiface.DynamoDBAPI
     tableName string
+    freshness time.Duration // How long a proxy lives after its last check, 0 to keep forever
+
+    indexMu       sync.RWMutex
+    activeIndexes map[string]bool
 }
 
 func NewDynamoDBStorage(cfg *config.Config) (*DynamoDBStorage, error) {
-    sess, err := session.NewSession(&aws.Config{
-        Region: aws.String(cfg.AWSRegion),
-        Credentials: credentials.NewStaticCredentials(
-            cfg.AWSAccessKeyID,
-            cfg.AWSSecretAccessKey,
-            "",
-        ),
-    })
+    sess, err := newAWSSession(cfg)
     if err != nil {
-        return nil, fmt.Errorf("failed to create AWS session: %v", err)
+        return nil, err
     }
 
-    client := dynamodb.New(sess)
+    clientConfig, err := dynamoDBClientConfig(cfg)
+    if err != nil {
+        return nil, err
+    }
+
+    client := dynamodb.New(sess, clientConfig)
+    instrumentClient(client)
     storage := &DynamoDBStorage{
         client:    client,
         tableName: cfg.DynamoDBTableName,
+        freshness: cfg.ProxyTTL,
     }
 
     // Ensure table exists
@@ -49,18 +113,22 @@ func NewDynamoDBStorage(cfg *config.Config) (*DynamoDBStorage, error) {
 
 func (s *DynamoDBStorage) ensureTableExists() error {
     // Check if table exists
-    _, err := s.client.DescribeTable(&dynamodb.DescribeTableInput{
+    output, err := s.client.DescribeTable(&dynamodb.DescribeTableInput{
         TableName: aws.String(s.tableName),
     })
     
     if err == nil {
-        log.Printf("Table %s already exists", s.tableName)
+        slog.Info("Table already exists", "table", s.tableName)
+        s.markActiveIndexes(output.Table)
+        s.migrateIndexes(output.Table)
+        s.ensureTimeToLive()
         return nil
     }
 
     // Create table if it doesn't exist
-    log.Printf("Creating table: %s", s.tableName)
+    slog.Info("Creating table", "table", s.tableName)
     
+    indexAttributes, indexes := indexDefinitions()
     input := &dynamodb.CreateTableInput{
         TableName: aws.String(s.tableName),
         KeySchema: []*dynamodb.KeySchemaElement{
@@ -69,13 +137,14 @@ func (s *DynamoDBStorage) ensureTableExists() error {
                 KeyType:       aws.String("HASH"),
             },
         },
-        AttributeDefinitions: []*dynamodb.AttributeDefinition{
+        AttributeDefinitions: append([]*dynamodb.AttributeDefinition{
             {
                 AttributeName: aws.String("proxy_key"),
                 AttributeType: aws.String("S"),
             },
-        },
-        BillingMode: aws.String("PAY_PER_REQUEST"),
+        }, indexAttributes...),
+        GlobalSecondaryIndexes: indexes,
+        BillingMode:            aws.String("PAY_PER_REQUEST"),
     }
 
     _, err = s.client.CreateTable(input)
@@ -84,7 +153,7 @@ func (s *DynamoDBStorage) ensureTableExists() error {
     }
 
     // Wait for table to be active
-    log.Printf("Waiting for table %s to be active...", s.tableName)
+    slog.Info("Waiting for table to be active", "table", s.tableName)
     err = s.client.WaitUntilTableExists(&dynamodb.DescribeTableInput{
         TableName: aws.String(s.tableName),
     })
@@ -92,13 +161,23 @@ func (s *DynamoDBStorage) ensureTableExists() error {
         return fmt.Errorf("failed to wait for table creation: %v", err)
     }
 
-    log.Printf("Table %s created successfully", s.tableName)
+    // Indexes are created along with the table and are active once it is
+    s.indexMu.Lock()
+    s.activeIndexes = make(map[string]bool)
+    for _, idx := range tableIndexes {
+        s.activeIndexes[idx.Name] = true
+    }
+    s.indexMu.Unlock()
+
+    slog.Info("Table created", "table", s.tableName)
+    s.ensureTimeToLive()
     return nil
 }
 
-func (s *DynamoDBStorage) BatchGetProxies(proxyKeys []string) (map[string]*models.ProxyData, error) {
+func (s *DynamoDBStorage) BatchGetProxies(ctx context.Context, proxyKeys []string) (map[string]*models.ProxyData, error) {
     const batchSize = 100
     result := make(map[string]*models.ProxyData)
+    var unprocessed []string
     
     for i := 0; i < len(proxyKeys); i += batchSize {
         end := i + batchSize
@@ -113,41 +192,157 @@ func (s *DynamoDBStorage) BatchGetProxies(proxyKeys []string) (map[string]*model
             }
         }
         
-        output, err := s.client.BatchGetItem(&dynamodb.BatchGetItemInput{
-            RequestItems: map[string]*dynamodb.KeysAndAttributes{
-                s.tableName: {Keys: keys},
-            },
-        })
-        if err != nil {
-            return nil, err
-        }
-        
-        if items, ok := output.Responses[s.tableName]; ok {
-            for _, item := range items {
-                var proxy models.ProxyData
-                if err := dynamodbattribute.UnmarshalMap(item, &proxy); err == nil {
-                    result[proxy.GetKey()] = &proxy
+        for attempt := 0; len(keys) > 0; attempt++ {
+            if attempt > 0 {
+                if attempt > maxBatchRetries {
+                    for _, key := range keys {
+                        unprocessed = append(unprocessed, aws.StringValue(key["proxy_key"].S))
+                    }
+                    break
+                }
+                if err := sleepContext(ctx, batchRetryDelay(attempt)); err != nil {
+                    return result, err
                 }
             }
+
+            output, err := s.client.BatchGetItemWithContext(ctx, &dynamodb.BatchGetItemInput{
+                RequestItems: map[string]*dynamodb.KeysAndAttributes{
+                    s.tableName: {Keys: keys},
+                },
+            })
+            if err != nil {
+                return nil, err
+            }
+            
+            if items, ok := output.Responses[s.tableName]; ok {
+                for _, item := range items {
+                    proxy, err := unmarshalProxy(item)
+                    if err == nil {
+                        result[proxy.GetKey()] = proxy
+                    }
+                }
+            }
+
+            keys = nil
+            if remaining, ok := output.UnprocessedKeys[s.tableName]; ok {
+                keys = remaining.Keys
+                metrics.ObserveDynamoThrottle("BatchGetItem", len(keys))
+            }
         }
     }
+
+    if len(unprocessed) > 0 {
+        return result, &UnprocessedError{Operation: "BatchGetItem", Keys: unprocessed}
+    }
     
     return result, nil
 }
 
-func (s *DynamoDBStorage) UpsertProxy(proxy *models.ProxyData) error {
-    // Set proxy key and updated timestamp
-    proxyKey := proxy.GetKey()
-    now := time.Now()
-    proxy.UpdatedAt = now
+func (s *DynamoDBStorage) ScanProxies(ctx context.Context, startKey string, limit int) ([]models.ProxyData, string, error) {
+    input := &dynamodb.ScanInput{
+        TableName: aws.String(s.tableName),
+    }
+    if limit > 0 {
+        input.Limit = aws.Int64(int64(limit))
+    }
+    if startKey != "" {
+        input.ExclusiveStartKey = map[string]*dynamodb.AttributeValue{
+            "proxy_key": {S: aws.String(startKey)},
+        }
+    }
+
+    output, err := s.client.ScanWithContext(ctx, input)
+    if err != nil {
+        return nil, "", fmt.Errorf("failed to scan proxies: %v", err)
+    }
+
+    proxies := make([]models.ProxyData, 0, len(output.Items))
+    for _, item := range output.Items {
+        proxy, err := unmarshalProxy(item)
+        if err != nil {
+            continue
+        }
+        proxies = append(proxies, *proxy)
+    }
+
+    nextKey := ""
+    if key, ok := output.LastEvaluatedKey["proxy_key"]; ok && key.S != nil {
+        nextKey = *key.S
+    }
+
+    return proxies, nextKey, nil
+}
+
+// QueryProxies returns the proxies matching the filter. Country filters are
+// served from the country index and protocol filters from the protocol index
+// when they are active, everything else scans the whole table. Either way
+// the rest of the filter is applied client side.
+func (s *DynamoDBStorage) QueryProxies(ctx context.Context, filter ProxyFilter) ([]models.ProxyData, error) {
+    var candidates []models.ProxyData
+    var err error
+    switch {
+    case filter.Country != "" && s.indexActive(countryIndexName):
+        candidates, err = s.QueryByCountry(ctx, strings.ToUpper(filter.Country), time.Time{}, 0)
+    case filter.Protocol != "" && s.indexActive(protocolIndexName):
+        candidates, err = s.QueryByProtocol(ctx, filter.Protocol, filter.MaxLatencyMs, 0)
+    default:
+        return s.scanProxies(ctx, filter)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    var proxies []models.ProxyData
+    for i := range candidates {
+        if filter.Matches(&candidates[i]) {
+            proxies = append(proxies, candidates[i])
+        }
+    }
+    return proxies, nil
+}
+
+// scanProxies scans the whole table for the proxies matching the filter
+func (s *DynamoDBStorage) scanProxies(ctx context.Context, filter ProxyFilter) ([]models.ProxyData, error) {
+    var proxies []models.ProxyData
+    startKey := ""
+
+    for {
+        page, nextKey, err := s.ScanProxies(ctx, startKey, 0)
+        if err != nil {
+            return nil, err
+        }
+
+        for i := range page {
+            if filter.Matches(&page[i]) {
+                proxies = append(proxies, page[i])
+            }
+        }
 
-    // Marshal the proxy data
-    item := map[string]*dynamodb.AttributeValue{
-        "proxy_key": {S: aws.String(proxyKey)},
+        if nextKey == "" {
+            return proxies, nil
+        }
+        startKey = nextKey
+    }
+}
+
+func unmarshalProxy(item map[string]*dynamodb.AttributeValue) (*models.ProxyData, error) {
+    var proxy models.ProxyData
+    decoder := dynamodbattribute.NewDecoder(func(d *dynamodbattribute.Decoder) {
+        d.MarshalOptions.TagKey = "dynamodb"
+    })
+    if err := decoder.Decode(&dynamodb.AttributeValue{M: item}, &proxy); err != nil {
+        return nil, err
     }
+    return &proxy, nil
+}
+
+// proxyItem builds the DynamoDB item stored for a proxy. The lease attributes
+// are left out, only AcquireLeases and ReleaseLease write them.
+func (s *DynamoDBStorage) proxyItem(proxy *models.ProxyData, now time.Time) (map[string]*dynamodb.AttributeValue, error) {
+    proxy.ExpiresAt = expiresAt(proxy, s.freshness)
 
-    // Add all proxy fields
     proxyMap := map[string]interface{}{
+        "proxy_key":              proxy.GetKey(),
         "id":                     proxy.ID,
         "ip":                     proxy.IP,
         "port":                   proxy.Port,
@@ -169,97 +364,270 @@ func (s *DynamoDBStorage) UpsertProxy(proxy *models.ProxyData) error {
         "up_time_success_count":  proxy.UpTimeSuccessCount,
         "up_time_try_count":      proxy.UpTimeTryCount,
         "updated_at":             now.Unix(),
+        "validated_at":           proxy.ValidatedAt.Unix(),
+        "valid_protocols":        proxy.ValidProtocols,
+        "connect_latency_ms":     proxy.ConnectLatencyMs,
+        "first_byte_latency_ms":  proxy.FirstByteLatencyMs,
+        "validation_error":       proxy.ValidationError,
+        "measured_anonymity":     proxy.MeasuredAnonymity,
+        "protocol":               protocolKey(proxy),
+        "latency_ms":             indexLatencyMs(proxy),
+        "ttl":                    proxy.ExpiresAt.Unix(),
+        "health_score":           proxy.HealthScore,
+        "health_successes":       proxy.HealthSuccesses,
+        "health_failures":        proxy.HealthFailures,
+        "last_success_at":        proxy.LastSuccessAt.Unix(),
     }
 
-    av, err := dynamodbattribute.MarshalMap(proxyMap)
+    item, err := dynamodbattribute.MarshalMap(proxyMap)
     if err != nil {
-        return fmt.Errorf("failed to marshal proxy data: %v", err)
+        return nil, err
     }
 
-    // Merge with item
-    for k, v := range av {
-        item[k] = v
+    // Index keys cannot be empty; leaving them out keeps the item out of the index
+    for _, idx := range tableIndexes {
+        if av := item[idx.HashKey]; av != nil && aws.StringValue(av.S) == "" {
+            delete(item, idx.HashKey)
+        }
+    }
+    if proxy.ExpiresAt.IsZero() {
+        delete(item, "ttl")
+    }
+    if proxy.LastSuccessAt.IsZero() {
+        delete(item, "last_success_at")
     }
 
-    _, err = s.client.PutItem(&dynamodb.PutItemInput{
-        TableName: aws.String(s.tableName),
-        Item:      item,
-    })
-    if err != nil {
-        return fmt.Errorf("failed to upsert proxy: %v", err)
+    return item, nil
+}
+
+// optionalAttributes lists the attributes proxyItem leaves out when they have
+// no value, which a write then has to remove
+func optionalAttributes() []string {
+    names := []string{"ttl", "last_success_at"}
+    for _, idx := range tableIndexes {
+        names = append(names, idx.HashKey)
     }
+    return names
+}
 
-    return nil
+// validationAttributes are the attributes RecordValidations writes: our own
+// validation results, the health history and what is derived from them
+var validationAttributes = []string{
+    "validated_at", "valid_protocols", "connect_latency_ms", "first_byte_latency_ms",
+    "validation_error", "measured_anonymity", "health_score", "health_successes",
+    "health_failures", "last_success_at", "protocol", "latency_ms", "ttl", "updated_at",
 }
 
-func (s *DynamoDBStorage) BatchUpsertProxies(proxies []models.ProxyData) error {
-    const batchSize = 25 // DynamoDB batch write limit
+// proxyUpdate builds the UpdateItem that stores the proxy. It sets every
+// attribute of its item, or only the given ones when attributes is not nil,
+// and removes the optional ones it has no value for. A put would replace the
+// lease attributes too, undoing any lease taken or released while the proxy
+// was being validated.
+func (s *DynamoDBStorage) proxyUpdate(proxy *models.ProxyData, now time.Time, attributes []string) (*dynamodb.UpdateItemInput, error) {
+    proxy.UpdatedAt = now
+    item, err := s.proxyItem(proxy, now)
+    if err != nil {
+        return nil, fmt.Errorf("failed to marshal proxy %s: %v", proxy.GetKey(), err)
+    }
+    key := item["proxy_key"]
+    delete(item, "proxy_key")
 
-    for i := 0; i < len(proxies); i += batchSize {
-        end := i + batchSize
-        if end > len(proxies) {
-            end = len(proxies)
+    written := make(map[string]bool)
+    if attributes == nil {
+        for name := range item {
+            written[name] = true
+        }
+    } else {
+        for _, name := range attributes {
+            written[name] = true
         }
+    }
 
-        batch := proxies[i:end]
-        if err := s.writeBatch(batch); err != nil {
-            return fmt.Errorf("failed to write batch: %v", err)
+    var present []string
+    for name := range item {
+        if written[name] {
+            present = append(present, name)
+        }
+    }
+    sort.Strings(present)
+
+    // Every name gets a placeholder, several are reserved words
+    names := make(map[string]*string)
+    values := make(map[string]*dynamodb.AttributeValue)
+    var set, remove []string
+    for _, name := range present {
+        placeholder := fmt.Sprintf("%d", len(names))
+        names["#a"+placeholder] = aws.String(name)
+        values[":v"+placeholder] = item[name]
+        set = append(set, "#a"+placeholder+" = :v"+placeholder)
+    }
+    for _, name := range optionalAttributes() {
+        if _, ok := item[name]; !ok && written[name] {
+            placeholder := fmt.Sprintf("#a%d", len(names))
+            names[placeholder] = aws.String(name)
+            remove = append(remove, placeholder)
         }
     }
 
-    return nil
+    expression := "SET " + strings.Join(set, ", ")
+    if len(remove) > 0 {
+        expression += " REMOVE " + strings.Join(remove, ", ")
+    }
+
+    return &dynamodb.UpdateItemInput{
+        TableName:                 aws.String(s.tableName),
+        Key:                       map[string]*dynamodb.AttributeValue{"proxy_key": key},
+        UpdateExpression:          aws.String(expression),
+        ExpressionAttributeNames:  names,
+        ExpressionAttributeValues: values,
+    }, nil
 }
 
-func (s *DynamoDBStorage) writeBatch(proxies []models.ProxyData) error {
-    writeRequests := make([]*dynamodb.WriteRequest, 0, len(proxies))
-    now := time.Now()
+func (s *DynamoDBStorage) UpsertProxy(ctx context.Context, proxy *models.ProxyData) error {
+    input, err := s.proxyUpdate(proxy, time.Now(), nil)
+    if err != nil {
+        return err
+    }
 
+    _, err = s.sendUpdates(ctx, []*dynamodb.UpdateItemInput{input})
+    return err
+}
+
+// BatchUpsertProxies writes the proxies with UpdateItem calls, as
+// BatchWriteItem only supports whole item puts, which would overwrite leases
+func (s *DynamoDBStorage) BatchUpsertProxies(ctx context.Context, proxies []models.ProxyData) error {
+    now := time.Now()
+    inputs := make([]*dynamodb.UpdateItemInput, 0, len(proxies))
     for _, proxy := range proxies {
-        proxy.UpdatedAt = now
-        proxyKey := proxy.GetKey()
-
-        proxyMap := map[string]interface{}{
-            "proxy_key":              proxyKey,
-            "id":                     proxy.ID,
-            "ip":                     proxy.IP,
-            "port":                   proxy.Port,
-            "anonymity":              proxy.Anonymity,
-            "asn":                    proxy.ASN,
-            "city":                   proxy.City,
-            "country":                proxy.Country,
-            "created_at":             proxy.CreatedAt.Unix(),
-            "google":                 proxy.Google,
-            "isp":                    proxy.ISP,
-            "last_checked":           proxy.LastChecked.Unix(),
-            "latency":                proxy.Latency,
-            "org":                    proxy.Org,
-            "protocols":              proxy.Protocols,
-            "region":                 proxy.Region,
-            "response_time":          proxy.ResponseTime,
-            "speed":                  proxy.Speed,
-            "up_time":                proxy.UpTime,
-            "up_time_success_count":  proxy.UpTimeSuccessCount,
-            "up_time_try_count":      proxy.UpTimeTryCount,
-            "updated_at":             now.Unix(),
+        input, err := s.proxyUpdate(&proxy, now, nil)
+        if err != nil {
+            return err
         }
+        inputs = append(inputs, input)
+    }
 
-        item, err := dynamodbattribute.MarshalMap(proxyMap)
+    _, err := s.sendUpdates(ctx, inputs)
+    return err
+}
+
+// RecordValidations writes only the validation and health attributes, each
+// conditioned on the stored validated_at still being the one the result
+// builds on. Provider data and validations written since are kept, and the
+// proxies they belong to are skipped.
+func (s *DynamoDBStorage) RecordValidations(ctx context.Context, updates []ValidationUpdate) (int, error) {
+    now := time.Now()
+    inputs := make([]*dynamodb.UpdateItemInput, 0, len(updates))
+    for _, update := range updates {
+        proxy := update.Proxy
+        input, err := s.proxyUpdate(&proxy, now, validationAttributes)
         if err != nil {
-            return fmt.Errorf("failed to marshal proxy: %v", err)
+            return 0, err
+        }
+        condition := "attribute_exists(proxy_key) AND validated_at = :since"
+        if update.Since.IsZero() {
+            // Items from before validation was added have no validated_at
+            condition = "attribute_exists(proxy_key) AND (attribute_not_exists(validated_at) OR validated_at = :since)"
         }
+        input.ConditionExpression = aws.String(condition)
+        input.ExpressionAttributeValues[":since"] = &dynamodb.AttributeValue{
+            N: aws.String(strconv.FormatInt(update.Since.Unix(), 10)),
+        }
+        inputs = append(inputs, input)
+    }
 
-        writeRequests = append(writeRequests, &dynamodb.WriteRequest{
-            PutRequest: &dynamodb.PutRequest{
-                Item: item,
-            },
+    return s.sendUpdates(ctx, inputs)
+}
+
+// sendUpdates sends up to 25 updates at a time, retrying failed ones like
+// unprocessed batch entries. Updates whose condition fails are skipped. It
+// returns how many were applied, and once every batch has been tried, an
+// *UnprocessedError listing the proxies that were not written.
+func (s *DynamoDBStorage) sendUpdates(ctx context.Context, inputs []*dynamodb.UpdateItemInput) (int, error) {
+    const batchSize = 25
+    var applied atomic.Int64
+    var unwritten []string
+    var lastErr error
+
+    for i := 0; i < len(inputs); i += batchSize {
+        end := i + batchSize
+        if end > len(inputs) {
+            end = len(inputs)
+        }
+
+        batch := make(map[string]*dynamodb.UpdateItemInput, end-i)
+        keys := make([]string, 0, end-i)
+        for _, input := range inputs[i:end] {
+            key := aws.StringValue(input.Key["proxy_key"].S)
+            batch[key] = input
+            keys = append(keys, key)
+        }
+
+        // Nothing more gets written once ctx is done
+        if err := ctx.Err(); err != nil {
+            for _, input := range inputs[i:] {
+                unwritten = append(unwritten, aws.StringValue(input.Key["proxy_key"].S))
+            }
+            lastErr = err
+            break
+        }
+
+        failed, err := retryWrites(ctx, keys, func(ctx context.Context, key string) error {
+            _, err := s.client.UpdateItemWithContext(ctx, batch[key])
+            if isConditionalCheckFailed(err) {
+                return nil
+            }
+            if err == nil {
+                applied.Add(1)
+            }
+            return err
         })
+        unwritten = append(unwritten, failed...)
+        if err != nil {
+            lastErr = err
+        }
     }
 
-    _, err := s.client.BatchWriteItem(&dynamodb.BatchWriteItemInput{
-        RequestItems: map[string][]*dynamodb.WriteRequest{
-            s.tableName: writeRequests,
-        },
-    })
+    if len(unwritten) > 0 {
+        return int(applied.Load()), &UnprocessedError{Operation: "UpdateItem", Keys: unwritten, Err: lastErr}
+    }
+    return int(applied.Load()), nil
+}
 
-    return err
+// retryWrites runs write for every key concurrently, retrying the keys whose
+// write failed with exponential backoff. It returns the keys that never
+// succeeded along with the last error seen.
+func retryWrites(ctx context.Context, keys []string, write func(ctx context.Context, key string) error) ([]string, error) {
+    var lastErr error
+    for attempt := 0; len(keys) > 0; attempt++ {
+        if attempt > 0 {
+            if attempt > maxBatchRetries {
+                return keys, lastErr
+            }
+            if err := sleepContext(ctx, batchRetryDelay(attempt)); err != nil {
+                return keys, err
+            }
+        }
+
+        errs := make([]error, len(keys))
+        var wg sync.WaitGroup
+        for i, key := range keys {
+            wg.Add(1)
+            go func(i int, key string) {
+                defer wg.Done()
+                errs[i] = write(ctx, key)
+            }(i, key)
+        }
+        wg.Wait()
+
+        var failed []string
+        for i, err := range errs {
+            if err != nil {
+                failed = append(failed, keys[i])
+                lastErr = err
+            }
+        }
+        keys = failed
+    }
+
+    return nil, nil
 }
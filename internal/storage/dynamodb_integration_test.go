@@ -0,0 +1,402 @@
+//go:build integration
+
+// The integration suite runs the DynamoDB backend against a local stand-in
+// such as DynamoDB Local:
+//
+//	docker run -p 8000:8000 amazon/dynamodb-local
+//	DYNAMODB_ENDPOINT=http://localhost:8000 go test -tags integration ./internal/storage/
+//
+// Every test creates its own table and deletes it afterwards. The tests are
+// skipped when DYNAMODB_ENDPOINT is not set.
+package storage
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "sort"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/aws/aws-sdk-go/aws"
+    "github.com/aws/aws-sdk-go/service/dynamodb"
+
+    "proxy-system/internal/config"
+    "proxy-system/internal/models"
+)
+
+func envOr(name, def string) string {
+    if value := os.Getenv(name); value != "" {
+        return value
+    }
+    return def
+}
+
+// newTestStorage creates a store on a fresh table at DYNAMODB_ENDPOINT.
+// DynamoDB Local accepts any credentials, so dummy keys are used unless real
+// ones are in the environment.
+func newTestStorage(t *testing.T) *DynamoDBStorage {
+    t.Helper()
+
+    endpoint := os.Getenv("DYNAMODB_ENDPOINT")
+    if endpoint == "" {
+        t.Skip("DYNAMODB_ENDPOINT is not set")
+    }
+
+    cfg := &config.Config{
+        StorageBackend:     config.StorageDynamoDB,
+        AWSAccessKeyID:     envOr("AWS_ACCESS_KEY_ID", "local"),
+        AWSSecretAccessKey: envOr("AWS_SECRET_ACCESS_KEY", "local"),
+        AWSRegion:          envOr("AWS_REGION", "eu-west-1"),
+        DynamoDBTableName:  fmt.Sprintf("proxies-test-%d", time.Now().UnixNano()),
+        DynamoDBEndpoint:   endpoint,
+        DynamoDBCAFile:     os.Getenv("DYNAMODB_CA_FILE"),
+        ProxyTTL:           time.Hour,
+    }
+
+    store, err := NewDynamoDBStorage(cfg)
+    if err != nil {
+        t.Fatalf("failed to create storage: %v", err)
+    }
+    t.Cleanup(func() {
+        _, err := store.client.DeleteTable(&dynamodb.DeleteTableInput{
+            TableName: aws.String(store.tableName),
+        })
+        if err != nil {
+            t.Logf("failed to delete table %s: %v", store.tableName, err)
+        }
+    })
+    return store
+}
+
+// testProxy returns a validated proxy with a unique address for i, checked
+// i seconds before now
+func testProxy(i int, country, protocol string, latencyMs float64, now time.Time) models.ProxyData {
+    checked := time.Unix(now.Unix()-int64(i), 0)
+    return models.ProxyData{
+        IP:                 fmt.Sprintf("10.0.%d.%d", i/256, i%256),
+        Port:               "8080",
+        Country:            country,
+        Protocols:          []string{protocol},
+        Anonymity:          "elite",
+        LastChecked:        checked,
+        ValidatedAt:        checked,
+        LastSuccessAt:      checked,
+        ValidProtocols:     []string{protocol},
+        FirstByteLatencyMs: latencyMs,
+    }
+}
+
+func keysOf(proxies []models.ProxyData) []string {
+    keys := make([]string, len(proxies))
+    for i := range proxies {
+        keys[i] = proxies[i].GetKey()
+    }
+    return keys
+}
+
+func TestEnsureTableExists(t *testing.T) {
+    store := newTestStorage(t)
+
+    output, err := store.client.DescribeTable(&dynamodb.DescribeTableInput{
+        TableName: aws.String(store.tableName),
+    })
+    if err != nil {
+        t.Fatalf("failed to describe table: %v", err)
+    }
+    if status := aws.StringValue(output.Table.TableStatus); status != dynamodb.TableStatusActive {
+        t.Fatalf("table status = %s, want %s", status, dynamodb.TableStatusActive)
+    }
+
+    created := make(map[string]bool)
+    for _, idx := range output.Table.GlobalSecondaryIndexes {
+        created[aws.StringValue(idx.IndexName)] = true
+    }
+    for _, idx := range tableIndexes {
+        if !created[idx.Name] {
+            t.Errorf("index %s was not created", idx.Name)
+        }
+        if !store.indexActive(idx.Name) {
+            t.Errorf("index %s is not marked active", idx.Name)
+        }
+    }
+
+    // A second run finds the table and leaves it alone
+    if err := store.ensureTableExists(); err != nil {
+        t.Fatalf("ensureTableExists on an existing table: %v", err)
+    }
+    for _, idx := range tableIndexes {
+        if !store.indexActive(idx.Name) {
+            t.Errorf("index %s is not marked active after the second run", idx.Name)
+        }
+    }
+}
+
+func TestBatchUpsertAndGet(t *testing.T) {
+    store := newTestStorage(t)
+    ctx := context.Background()
+    now := time.Now()
+
+    // More than one BatchWriteItem (25) and one BatchGetItem (100) worth
+    const count = 130
+    proxies := make([]models.ProxyData, count)
+    for i := range proxies {
+        proxies[i] = testProxy(i, "DE", "http", float64(100+i), now)
+    }
+
+    if err := store.BatchUpsertProxies(ctx, proxies); err != nil {
+        t.Fatalf("BatchUpsertProxies: %v", err)
+    }
+
+    missing := "192.0.2.1:1"
+    got, err := store.BatchGetProxies(ctx, append(keysOf(proxies), missing))
+    if err != nil {
+        t.Fatalf("BatchGetProxies: %v", err)
+    }
+    if len(got) != count {
+        t.Fatalf("got %d proxies, want %d", len(got), count)
+    }
+    if _, ok := got[missing]; ok {
+        t.Errorf("got a proxy for the unknown key %s", missing)
+    }
+
+    want := proxies[42]
+    stored, ok := got[want.GetKey()]
+    if !ok {
+        t.Fatalf("proxy %s is missing", want.GetKey())
+    }
+    if stored.Country != want.Country || stored.FirstByteLatencyMs != want.FirstByteLatencyMs ||
+        !stored.LastChecked.Equal(want.LastChecked) || len(stored.ValidProtocols) != 1 {
+        t.Errorf("stored proxy = %+v, want %+v", stored, want)
+    }
+    if !stored.ExpiresAt.Equal(want.LastChecked.Add(time.Hour)) {
+        t.Errorf("expiry = %v, want %v", stored.ExpiresAt, want.LastChecked.Add(time.Hour))
+    }
+
+    // Upserting again replaces the items
+    for i := range proxies {
+        proxies[i].FirstByteLatencyMs = 50
+    }
+    if err := store.BatchUpsertProxies(ctx, proxies); err != nil {
+        t.Fatalf("BatchUpsertProxies again: %v", err)
+    }
+    single := proxies[0]
+    single.Country = "FR"
+    if err := store.UpsertProxy(ctx, &single); err != nil {
+        t.Fatalf("UpsertProxy: %v", err)
+    }
+
+    got, err = store.BatchGetProxies(ctx, keysOf(proxies))
+    if err != nil {
+        t.Fatalf("BatchGetProxies after update: %v", err)
+    }
+    for key, proxy := range got {
+        if proxy.FirstByteLatencyMs != 50 {
+            t.Errorf("proxy %s latency = %v, want 50", key, proxy.FirstByteLatencyMs)
+        }
+    }
+    if country := got[single.GetKey()].Country; country != "FR" {
+        t.Errorf("single upsert country = %s, want FR", country)
+    }
+}
+
+func TestScanProxiesPages(t *testing.T) {
+    store := newTestStorage(t)
+    ctx := context.Background()
+    now := time.Now()
+
+    const count = 60
+    proxies := make([]models.ProxyData, count)
+    for i := range proxies {
+        proxies[i] = testProxy(i, "US", "socks5", 200, now)
+    }
+    if err := store.BatchUpsertProxies(ctx, proxies); err != nil {
+        t.Fatalf("BatchUpsertProxies: %v", err)
+    }
+
+    seen := make(map[string]bool)
+    pages := 0
+    startKey := ""
+    for {
+        page, nextKey, err := store.ScanProxies(ctx, startKey, 25)
+        if err != nil {
+            t.Fatalf("ScanProxies: %v", err)
+        }
+        pages++
+        for i := range page {
+            seen[page[i].GetKey()] = true
+        }
+        if nextKey == "" {
+            break
+        }
+        startKey = nextKey
+    }
+
+    if len(seen) != count {
+        t.Errorf("scanned %d proxies, want %d", len(seen), count)
+    }
+    if pages < 3 {
+        t.Errorf("scanned %d pages, want at least 3", pages)
+    }
+}
+
+func TestQueries(t *testing.T) {
+    store := newTestStorage(t)
+    ctx := context.Background()
+    now := time.Now()
+
+    proxies := []models.ProxyData{
+        testProxy(0, "DE", "http", 300, now),
+        testProxy(1, "DE", "socks5", 100, now),
+        testProxy(2, "DE", "http", 120, now),
+        testProxy(3, "US", "http", 80, now),
+        testProxy(4, "US", "socks5", 500, now),
+        testProxy(5, "US", "socks5", 90, now),
+    }
+    // Works over http as well, so http queries must find it under its set
+    proxies[5].ValidProtocols = []string{"http", "socks5"}
+    if err := store.BatchUpsertProxies(ctx, proxies); err != nil {
+        t.Fatalf("BatchUpsertProxies: %v", err)
+    }
+
+    german, err := store.QueryProxies(ctx, ProxyFilter{Country: "de"})
+    if err != nil {
+        t.Fatalf("QueryProxies by country: %v", err)
+    }
+    if len(german) != 3 {
+        t.Errorf("got %d German proxies, want 3", len(german))
+    }
+
+    httpProxies, err := store.QueryProxies(ctx, ProxyFilter{Protocol: "HTTP"})
+    if err != nil {
+        t.Fatalf("QueryProxies by protocol: %v", err)
+    }
+    if len(httpProxies) != 4 {
+        t.Errorf("got %d http proxies, want 4", len(httpProxies))
+    }
+
+    fastSOCKS, err := store.QueryProxies(ctx, ProxyFilter{Protocol: "socks5", MaxLatencyMs: 200})
+    if err != nil {
+        t.Fatalf("QueryProxies by protocol: %v", err)
+    }
+    wantSOCKS := []string{proxies[5].GetKey(), proxies[1].GetKey()}
+    if keys := keysOf(fastSOCKS); strings.Join(keys, " ") != strings.Join(wantSOCKS, " ") {
+        t.Errorf("got %v, want %v", keys, wantSOCKS)
+    }
+
+    // Most recently checked first, and proxies[0] is the most recent
+    recent, err := store.QueryByCountry(ctx, "DE", proxies[2].LastChecked, 2)
+    if err != nil {
+        t.Fatalf("QueryByCountry: %v", err)
+    }
+    if keys := keysOf(recent); len(keys) != 2 || keys[0] != proxies[0].GetKey() || keys[1] != proxies[1].GetKey() {
+        t.Errorf("QueryByCountry = %v, want [%s %s]", keys, proxies[0].GetKey(), proxies[1].GetKey())
+    }
+
+    fastHTTP, err := store.QueryByProtocol(ctx, "http", 150, 0)
+    if err != nil {
+        t.Fatalf("QueryByProtocol: %v", err)
+    }
+    want := []string{proxies[3].GetKey(), proxies[5].GetKey(), proxies[2].GetKey()}
+    if keys := keysOf(fastHTTP); strings.Join(keys, " ") != strings.Join(want, " ") {
+        t.Errorf("QueryByProtocol = %v, want %v", keys, want)
+    }
+}
+
+func TestLeases(t *testing.T) {
+    store := newTestStorage(t)
+    ctx := context.Background()
+    now := time.Now()
+
+    proxies := make([]models.ProxyData, 5)
+    for i := range proxies {
+        proxies[i] = testProxy(i, "DE", "http", 100, now)
+    }
+    if err := store.BatchUpsertProxies(ctx, proxies); err != nil {
+        t.Fatalf("BatchUpsertProxies: %v", err)
+    }
+
+    first, err := store.AcquireLeases(ctx, "worker-a", ProxyFilter{}, 2, time.Minute, now)
+    if err != nil {
+        t.Fatalf("AcquireLeases for worker-a: %v", err)
+    }
+    second, err := store.AcquireLeases(ctx, "worker-b", ProxyFilter{}, 5, time.Minute, now)
+    if err != nil {
+        t.Fatalf("AcquireLeases for worker-b: %v", err)
+    }
+    if len(first) != 2 || len(second) != 3 {
+        t.Fatalf("leased %d and %d proxies, want 2 and 3", len(first), len(second))
+    }
+
+    leased := append(keysOf(first), keysOf(second)...)
+    sort.Strings(leased)
+    for i := 1; i < len(leased); i++ {
+        if leased[i] == leased[i-1] {
+            t.Errorf("proxy %s was leased twice", leased[i])
+        }
+    }
+
+    key := first[0].GetKey()
+    if err := store.ReleaseLease(ctx, key, "worker-b", true); err != ErrLeaseNotHeld {
+        t.Errorf("release by another worker = %v, want %v", err, ErrLeaseNotHeld)
+    }
+    if err := store.ReleaseLease(ctx, key, "worker-a", true); err != nil {
+        t.Fatalf("ReleaseLease: %v", err)
+    }
+
+    got, err := store.BatchGetProxies(ctx, []string{key})
+    if err != nil {
+        t.Fatalf("BatchGetProxies: %v", err)
+    }
+    if proxy := got[key]; proxy.LeaseOwner != "" || proxy.LeaseSuccesses != 1 {
+        t.Errorf("released proxy has owner %q and %d successes, want none and 1", proxy.LeaseOwner, proxy.LeaseSuccesses)
+    }
+
+    // Upserts from a cycle that read the proxies before any lease leave leases alone
+    if err := store.BatchUpsertProxies(ctx, proxies); err != nil {
+        t.Fatalf("BatchUpsertProxies after leasing: %v", err)
+    }
+    held := second[0].GetKey()
+    got, err = store.BatchGetProxies(ctx, []string{key, held})
+    if err != nil {
+        t.Fatalf("BatchGetProxies: %v", err)
+    }
+    if proxy := got[key]; proxy.LeaseSuccesses != 1 {
+        t.Errorf("upsert reset the lease successes of %s to %d, want 1", key, proxy.LeaseSuccesses)
+    }
+    if proxy := got[held]; proxy.LeaseOwner != "worker-b" {
+        t.Errorf("upsert changed the lease owner of %s to %q, want worker-b", held, proxy.LeaseOwner)
+    }
+}
+
+func TestPurgeExpired(t *testing.T) {
+    store := newTestStorage(t)
+    ctx := context.Background()
+    now := time.Now()
+
+    fresh := testProxy(0, "DE", "http", 100, now)
+    stale := testProxy(1, "DE", "http", 100, now.Add(-2*time.Hour))
+    if err := store.BatchUpsertProxies(ctx, []models.ProxyData{fresh, stale}); err != nil {
+        t.Fatalf("BatchUpsertProxies: %v", err)
+    }
+
+    purged, err := store.PurgeExpired(ctx, now)
+    if err != nil {
+        t.Fatalf("PurgeExpired: %v", err)
+    }
+    if purged != 1 {
+        t.Errorf("purged %d proxies, want 1", purged)
+    }
+
+    got, err := store.BatchGetProxies(ctx, []string{fresh.GetKey(), stale.GetKey()})
+    if err != nil {
+        t.Fatalf("BatchGetProxies: %v", err)
+    }
+    if _, ok := got[fresh.GetKey()]; !ok {
+        t.Errorf("fresh proxy %s was purged", fresh.GetKey())
+    }
+    if _, ok := got[stale.GetKey()]; ok {
+        t.Errorf("stale proxy %s was kept", stale.GetKey())
+    }
+}
@@ -0,0 +1,323 @@
+package storage
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "sort"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/aws/aws-sdk-go/aws"
+    "github.com/aws/aws-sdk-go/aws/awserr"
+    "github.com/aws/aws-sdk-go/aws/request"
+    "github.com/aws/aws-sdk-go/service/dynamodb"
+    "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+
+    "proxy-system/internal/models"
+)
+
+// fakeDynamoDB stands in for the calls under test. Calls it does not
+// override panic through the nil embedded interface.
+type fakeDynamoDB struct {
+    dynamodbiface.DynamoDBAPI
+
+    mu          sync.Mutex
+    failUpdates map[string]int // Proxy key to how many more UpdateItem calls fail, -1 for all
+    updated     map[string]*dynamodb.UpdateItemInput
+
+    scanKeys    []string        // Returned by every scan
+    failDeletes map[string]int  // Like failUpdates, for DeleteItem
+    keepItems   map[string]bool // Proxy keys whose delete condition fails
+    deleted     map[string]*dynamodb.DeleteItemInput
+
+    unprocessedGets map[string]int // Like failUpdates, for keys BatchGetItem returns unprocessed
+    getRequests     [][]string     // Keys asked for by each BatchGetItem call
+}
+
+func (f *fakeDynamoDB) UpdateItemWithContext(ctx aws.Context, input *dynamodb.UpdateItemInput, opts ...request.Option) (*dynamodb.UpdateItemOutput, error) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    key := aws.StringValue(input.Key["proxy_key"].S)
+    if n := f.failUpdates[key]; n != 0 {
+        if n > 0 {
+            f.failUpdates[key] = n - 1
+        }
+        return nil, awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "throttled", nil)
+    }
+
+    if f.updated == nil {
+        f.updated = make(map[string]*dynamodb.UpdateItemInput)
+    }
+    f.updated[key] = input
+    return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (f *fakeDynamoDB) ScanPagesWithContext(ctx aws.Context, input *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool, opts ...request.Option) error {
+    output := &dynamodb.ScanOutput{}
+    for _, key := range f.scanKeys {
+        output.Items = append(output.Items, map[string]*dynamodb.AttributeValue{"proxy_key": {S: aws.String(key)}})
+    }
+    fn(output, true)
+    return nil
+}
+
+func (f *fakeDynamoDB) DeleteItemWithContext(ctx aws.Context, input *dynamodb.DeleteItemInput, opts ...request.Option) (*dynamodb.DeleteItemOutput, error) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    key := aws.StringValue(input.Key["proxy_key"].S)
+    if n := f.failDeletes[key]; n != 0 {
+        if n > 0 {
+            f.failDeletes[key] = n - 1
+        }
+        return nil, awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "throttled", nil)
+    }
+    if f.keepItems[key] {
+        return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "condition failed", nil)
+    }
+
+    if f.deleted == nil {
+        f.deleted = make(map[string]*dynamodb.DeleteItemInput)
+    }
+    f.deleted[key] = input
+    return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (f *fakeDynamoDB) BatchGetItemWithContext(ctx aws.Context, input *dynamodb.BatchGetItemInput, opts ...request.Option) (*dynamodb.BatchGetItemOutput, error) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    output := &dynamodb.BatchGetItemOutput{
+        Responses:       make(map[string][]map[string]*dynamodb.AttributeValue),
+        UnprocessedKeys: make(map[string]*dynamodb.KeysAndAttributes),
+    }
+    for table, request := range input.RequestItems {
+        var requested []string
+        for _, key := range request.Keys {
+            proxyKey := aws.StringValue(key["proxy_key"].S)
+            requested = append(requested, proxyKey)
+
+            if n := f.unprocessedGets[proxyKey]; n != 0 {
+                if n > 0 {
+                    f.unprocessedGets[proxyKey] = n - 1
+                }
+                if output.UnprocessedKeys[table] == nil {
+                    output.UnprocessedKeys[table] = &dynamodb.KeysAndAttributes{}
+                }
+                output.UnprocessedKeys[table].Keys = append(output.UnprocessedKeys[table].Keys, key)
+                continue
+            }
+
+            ip, port, _ := strings.Cut(proxyKey, ":")
+            output.Responses[table] = append(output.Responses[table], map[string]*dynamodb.AttributeValue{
+                "proxy_key": {S: aws.String(proxyKey)},
+                "ip":        {S: aws.String(ip)},
+                "port":      {S: aws.String(port)},
+            })
+        }
+        f.getRequests = append(f.getRequests, requested)
+    }
+    return output, nil
+}
+
+// newFakeStorage returns a storage backed by the fake with the retry backoff
+// shortened for the test
+func newFakeStorage(t *testing.T, client dynamodbiface.DynamoDBAPI) *DynamoDBStorage {
+    t.Helper()
+
+    base, max := batchRetryBaseDelay, batchRetryMaxDelay
+    batchRetryBaseDelay, batchRetryMaxDelay = time.Millisecond, time.Millisecond
+    t.Cleanup(func() { batchRetryBaseDelay, batchRetryMaxDelay = base, max })
+
+    return &DynamoDBStorage{client: client, tableName: "proxies"}
+}
+
+func fakeProxy(ip string) models.ProxyData {
+    return models.ProxyData{IP: ip, Port: "8080", Protocols: []string{"http"}, CreatedAt: time.Now()}
+}
+
+func TestBatchUpsertProxiesRetriesFailedWrites(t *testing.T) {
+    fake := &fakeDynamoDB{failUpdates: map[string]int{
+        "10.0.0.1:8080": 2,  // Throttled twice, then written
+        "10.0.0.2:8080": -1, // Never written
+    }}
+    s := newFakeStorage(t, fake)
+
+    proxies := []models.ProxyData{fakeProxy("10.0.0.1"), fakeProxy("10.0.0.2"), fakeProxy("10.0.0.3")}
+    err := s.BatchUpsertProxies(context.Background(), proxies)
+
+    var unprocessed *UnprocessedError
+    if !errors.As(err, &unprocessed) {
+        t.Fatalf("BatchUpsertProxies error = %v, want an *UnprocessedError", err)
+    }
+    if len(unprocessed.Keys) != 1 || unprocessed.Keys[0] != "10.0.0.2:8080" {
+        t.Errorf("unprocessed keys = %v, want [10.0.0.2:8080]", unprocessed.Keys)
+    }
+    var awsErr awserr.Error
+    if !errors.As(err, &awsErr) || awsErr.Code() != dynamodb.ErrCodeProvisionedThroughputExceededException {
+        t.Errorf("error does not wrap the last DynamoDB error: %v", err)
+    }
+
+    var written []string
+    for key := range fake.updated {
+        written = append(written, key)
+    }
+    sort.Strings(written)
+    if strings.Join(written, ",") != "10.0.0.1:8080,10.0.0.3:8080" {
+        t.Errorf("written = %v, want the two proxies that did not keep failing", written)
+    }
+}
+
+func TestBatchUpsertProxiesLeavesLeasesAlone(t *testing.T) {
+    fake := &fakeDynamoDB{}
+    s := newFakeStorage(t, fake)
+
+    if err := s.BatchUpsertProxies(context.Background(), []models.ProxyData{fakeProxy("10.0.0.1")}); err != nil {
+        t.Fatal(err)
+    }
+
+    input := fake.updated["10.0.0.1:8080"]
+    if input == nil {
+        t.Fatal("proxy was not written")
+    }
+    for _, name := range input.ExpressionAttributeNames {
+        if strings.HasPrefix(aws.StringValue(name), "lease_") {
+            t.Errorf("update touches %s: %s", aws.StringValue(name), aws.StringValue(input.UpdateExpression))
+        }
+    }
+}
+
+func TestPurgeExpiredDeletesConditionally(t *testing.T) {
+    fake := &fakeDynamoDB{
+        scanKeys:    []string{"10.0.0.1:8080", "10.0.0.2:8080", "10.0.0.3:8080"},
+        failDeletes: map[string]int{"10.0.0.2:8080": 1},     // Throttled once, then deleted
+        keepItems:   map[string]bool{"10.0.0.3:8080": true}, // Refreshed or leased since the scan
+    }
+    s := newFakeStorage(t, fake)
+
+    purged, err := s.PurgeExpired(context.Background(), time.Now())
+    if err != nil {
+        t.Fatal(err)
+    }
+    if purged != 2 {
+        t.Errorf("purged = %d, want 2", purged)
+    }
+    if fake.deleted["10.0.0.3:8080"] != nil || len(fake.deleted) != 2 {
+        t.Errorf("deleted %d proxies, want the two whose condition held", len(fake.deleted))
+    }
+
+    for key, input := range fake.deleted {
+        condition := aws.StringValue(input.ConditionExpression)
+        if !strings.Contains(condition, "#ttl < :now") || !strings.Contains(condition, "lease_expiry") {
+            t.Errorf("delete of %s is conditioned on %q, want expiry and lease checks", key, condition)
+        }
+    }
+}
+
+func TestRecordValidationsWritesOnlyValidation(t *testing.T) {
+    fake := &fakeDynamoDB{}
+    s := newFakeStorage(t, fake)
+
+    since := time.Now().Add(-time.Hour).Truncate(time.Second)
+    proxy := fakeProxy("10.0.0.1")
+    proxy.Country = "US"
+    proxy.ValidatedAt = time.Now()
+    proxy.ValidProtocols = []string{"http"}
+
+    written, err := s.RecordValidations(context.Background(), []ValidationUpdate{{Proxy: proxy, Since: since}})
+    if err != nil || written != 1 {
+        t.Fatalf("RecordValidations = %d, %v, want 1 written", written, err)
+    }
+
+    input := fake.updated["10.0.0.1:8080"]
+    allowed := make(map[string]bool)
+    for _, name := range validationAttributes {
+        allowed[name] = true
+    }
+    for _, name := range input.ExpressionAttributeNames {
+        if !allowed[aws.StringValue(name)] {
+            t.Errorf("update touches %s, which is not a validation attribute", aws.StringValue(name))
+        }
+    }
+    if condition := aws.StringValue(input.ConditionExpression); !strings.Contains(condition, "validated_at = :since") {
+        t.Errorf("condition = %q, want it to check validated_at", condition)
+    }
+    if got := aws.StringValue(input.ExpressionAttributeValues[":since"].N); got != fmt.Sprint(since.Unix()) {
+        t.Errorf(":since = %s, want %d", got, since.Unix())
+    }
+}
+
+func TestBatchGetProxiesRetriesUnprocessedKeys(t *testing.T) {
+    tests := []struct {
+        name            string
+        unprocessedGets map[string]int
+        wantFound       []string
+        wantUnprocessed []string
+        wantRequests    int
+    }{
+        {
+            name:         "all processed",
+            wantFound:    []string{"10.0.0.1:8080", "10.0.0.2:8080", "10.0.0.3:8080"},
+            wantRequests: 1,
+        },
+        {
+            name:            "unprocessed twice",
+            unprocessedGets: map[string]int{"10.0.0.2:8080": 2},
+            wantFound:       []string{"10.0.0.1:8080", "10.0.0.2:8080", "10.0.0.3:8080"},
+            wantRequests:    3,
+        },
+        {
+            name:            "never processed",
+            unprocessedGets: map[string]int{"10.0.0.2:8080": -1},
+            wantFound:       []string{"10.0.0.1:8080", "10.0.0.3:8080"},
+            wantUnprocessed: []string{"10.0.0.2:8080"},
+            wantRequests:    maxBatchRetries + 1,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            fake := &fakeDynamoDB{unprocessedGets: tt.unprocessedGets}
+            s := newFakeStorage(t, fake)
+
+            got, err := s.BatchGetProxies(context.Background(), []string{"10.0.0.1:8080", "10.0.0.2:8080", "10.0.0.3:8080"})
+
+            var found []string
+            for key := range got {
+                found = append(found, key)
+            }
+            sort.Strings(found)
+            if strings.Join(found, ",") != strings.Join(tt.wantFound, ",") {
+                t.Errorf("found = %v, want %v", found, tt.wantFound)
+            }
+
+            if tt.wantUnprocessed == nil {
+                if err != nil {
+                    t.Fatalf("BatchGetProxies: %v", err)
+                }
+            } else {
+                var unprocessed *UnprocessedError
+                if !errors.As(err, &unprocessed) || unprocessed.Operation != "BatchGetItem" {
+                    t.Fatalf("BatchGetProxies error = %v, want a BatchGetItem *UnprocessedError", err)
+                }
+                if strings.Join(unprocessed.Keys, ",") != strings.Join(tt.wantUnprocessed, ",") {
+                    t.Errorf("unprocessed keys = %v, want %v", unprocessed.Keys, tt.wantUnprocessed)
+                }
+            }
+
+            if len(fake.getRequests) != tt.wantRequests {
+                t.Fatalf("BatchGetItem called %d times, want %d", len(fake.getRequests), tt.wantRequests)
+            }
+            // Retries only ask for the keys that were left unprocessed
+            for i, keys := range fake.getRequests[1:] {
+                if len(keys) != 1 || keys[0] != "10.0.0.2:8080" {
+                    t.Errorf("retry %d asked for %v, want only 10.0.0.2:8080", i+1, keys)
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+    "context"
+    "fmt"
+    "log/slog"
+    "strconv"
+    "sync/atomic"
+    "time"
+
+    "github.com/aws/aws-sdk-go/aws"
+    "github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// ensureTimeToLive enables DynamoDB TTL on the ttl attribute. Failures are
+// only logged, since PurgeExpired covers stand-ins without TTL support.
+func (s *DynamoDBStorage) ensureTimeToLive() {
+    if s.freshness <= 0 {
+        return
+    }
+
+    output, err := s.client.DescribeTimeToLive(&dynamodb.DescribeTimeToLiveInput{
+        TableName: aws.String(s.tableName),
+    })
+    if err != nil {
+        slog.Warn("Failed to describe TTL", "table", s.tableName, "error", err)
+        return
+    }
+
+    if description := output.TimeToLiveDescription; description != nil {
+        switch aws.StringValue(description.TimeToLiveStatus) {
+        case dynamodb.TimeToLiveStatusEnabled, dynamodb.TimeToLiveStatusEnabling:
+            if name := aws.StringValue(description.AttributeName); name != "ttl" {
+                slog.Warn("Table already expires items on another attribute", "table", s.tableName, "attribute", name)
+            }
+            return
+        }
+    }
+
+    slog.Info("Enabling TTL", "table", s.tableName)
+    _, err = s.client.UpdateTimeToLive(&dynamodb.UpdateTimeToLiveInput{
+        TableName: aws.String(s.tableName),
+        TimeToLiveSpecification: &dynamodb.TimeToLiveSpecification{
+            AttributeName: aws.String("ttl"),
+            Enabled:       aws.Bool(true),
+        },
+    })
+    if err != nil {
+        slog.Warn("Failed to enable TTL", "table", s.tableName, "error", err)
+    }
+}
+
+// PurgeExpired deletes expired proxies explicitly, for environments where
+// DynamoDB TTL is unavailable or too slow. Items written before TTL was
+// introduced have no ttl attribute and are judged by last_checked instead.
+// Every delete repeats the expiry check and requires the proxy to be unleased,
+// so a proxy refreshed or leased since the scan is kept.
+func (s *DynamoDBStorage) PurgeExpired(ctx context.Context, now time.Time) (int, error) {
+    expired := "#ttl < :now"
+    values := map[string]*dynamodb.AttributeValue{
+        ":now": {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+    }
+    if s.freshness > 0 {
+        expired = "(#ttl < :now OR (attribute_not_exists(#ttl) AND last_checked < :cutoff))"
+        values[":cutoff"] = &dynamodb.AttributeValue{
+            N: aws.String(strconv.FormatInt(now.Add(-s.freshness).Unix(), 10)),
+        }
+    }
+    names := map[string]*string{"#ttl": aws.String("ttl")}
+
+    var keys []string
+    err := s.client.ScanPagesWithContext(ctx, &dynamodb.ScanInput{
+        TableName:                 aws.String(s.tableName),
+        ProjectionExpression:      aws.String("proxy_key"),
+        FilterExpression:          aws.String(expired),
+        ExpressionAttributeNames:  names,
+        ExpressionAttributeValues: values,
+    }, func(output *dynamodb.ScanOutput, lastPage bool) bool {
+        for _, item := range output.Items {
+            if key, ok := item["proxy_key"]; ok && key.S != nil {
+                keys = append(keys, *key.S)
+            }
+        }
+        return true
+    })
+    if err != nil {
+        return 0, fmt.Errorf("failed to scan expired proxies: %v", err)
+    }
+
+    condition := aws.String(expired + " AND (attribute_not_exists(lease_expiry) OR lease_expiry <= :now)")
+    var purged atomic.Int64
+    deleteExpired := func(ctx context.Context, key string) error {
+        _, err := s.client.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+            TableName: aws.String(s.tableName),
+            Key: map[string]*dynamodb.AttributeValue{
+                "proxy_key": {S: aws.String(key)},
+            },
+            ConditionExpression:       condition,
+            ExpressionAttributeNames:  names,
+            ExpressionAttributeValues: values,
+        })
+        if isConditionalCheckFailed(err) {
+            return nil
+        }
+        if err == nil {
+            purged.Add(1)
+        }
+        return err
+    }
+
+    const batchSize = 25 // Deletes in flight at once
+    for i := 0; i < len(keys); i += batchSize {
+        end := i + batchSize
+        if end > len(keys) {
+            end = len(keys)
+        }
+
+        if failed, err := retryWrites(ctx, keys[i:end], deleteExpired); len(failed) > 0 {
+            return int(purged.Load()), fmt.Errorf("failed to delete expired proxies: %w",
+                &UnprocessedError{Operation: "DeleteItem", Keys: failed, Err: err})
+        }
+    }
+
+    return int(purged.Load()), nil
+}
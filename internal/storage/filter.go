@@ -0,0 +1,54 @@
+package storage
+
+import (
+    "strings"
+
+    "proxy-system/internal/models"
+)
+
+// ProxyFilter selects stored proxies. Zero values match everything.
+type ProxyFilter struct {
+    Country      string
+    Protocol     string
+    Anonymity    string
+    Google       *bool
+    MaxLatencyMs float64
+}
+
+// Matches reports whether the proxy passes every set criterion. Protocol,
+// anonymity and latency use our own measurements where we have them.
+func (f ProxyFilter) Matches(p *models.ProxyData) bool {
+    if f.Country != "" && !strings.EqualFold(p.Country, f.Country) {
+        return false
+    }
+
+    if f.Protocol != "" {
+        found := false
+        for _, protocol := range p.EffectiveProtocols() {
+            if strings.EqualFold(protocol, f.Protocol) {
+                found = true
+                break
+            }
+        }
+        if !found {
+            return false
+        }
+    }
+
+    if f.Anonymity != "" && !strings.EqualFold(p.EffectiveAnonymity(), f.Anonymity) {
+        return false
+    }
+
+    if f.Google != nil && p.Google != *f.Google {
+        return false
+    }
+
+    if f.MaxLatencyMs > 0 {
+        latency := p.EffectiveLatencyMs()
+        if latency <= 0 || latency > f.MaxLatencyMs {
+            return false
+        }
+    }
+
+    return true
+}
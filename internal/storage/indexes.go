@@ -0,0 +1,371 @@
+package storage
+
+import (
+    "context"
+    "fmt"
+    "log/slog"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/aws/aws-sdk-go/aws"
+    "github.com/aws/aws-sdk-go/service/dynamodb"
+
+    "proxy-system/internal/models"
+)
+
+// Global secondary indexes maintained on the proxy table
+const (
+    countryIndexName  = "country-last_checked-index"
+    protocolIndexName = "protocol-latency_ms-index"
+)
+
+// indexPollInterval is how often an index being built is checked on
+const indexPollInterval = 20 * time.Second
+
+// unknownLatencyMs is indexed for proxies without a known latency, so they
+// stay in the protocol index and sort after every measured one
+const unknownLatencyMs = 1e9
+
+// tableIndex describes a GSI with a string hash key and a number range key
+type tableIndex struct {
+    Name     string
+    HashKey  string
+    RangeKey string
+}
+
+var tableIndexes = []tableIndex{
+    {Name: countryIndexName, HashKey: "country", RangeKey: "last_checked"},
+    {Name: protocolIndexName, HashKey: "protocol", RangeKey: "latency_ms"},
+}
+
+func (idx tableIndex) attributeDefinitions() []*dynamodb.AttributeDefinition {
+    return []*dynamodb.AttributeDefinition{
+        {AttributeName: aws.String(idx.HashKey), AttributeType: aws.String("S")},
+        {AttributeName: aws.String(idx.RangeKey), AttributeType: aws.String("N")},
+    }
+}
+
+func (idx tableIndex) keySchema() []*dynamodb.KeySchemaElement {
+    return []*dynamodb.KeySchemaElement{
+        {AttributeName: aws.String(idx.HashKey), KeyType: aws.String("HASH")},
+        {AttributeName: aws.String(idx.RangeKey), KeyType: aws.String("RANGE")},
+    }
+}
+
+func (idx tableIndex) projection() *dynamodb.Projection {
+    return &dynamodb.Projection{ProjectionType: aws.String("ALL")}
+}
+
+// indexDefinitions returns the attribute definitions and index definitions
+// used when creating the table
+func indexDefinitions() ([]*dynamodb.AttributeDefinition, []*dynamodb.GlobalSecondaryIndex) {
+    var attributes []*dynamodb.AttributeDefinition
+    var indexes []*dynamodb.GlobalSecondaryIndex
+
+    for _, idx := range tableIndexes {
+        attributes = append(attributes, idx.attributeDefinitions()...)
+        indexes = append(indexes, &dynamodb.GlobalSecondaryIndex{
+            IndexName:  aws.String(idx.Name),
+            KeySchema:  idx.keySchema(),
+            Projection: idx.projection(),
+        })
+    }
+
+    return attributes, indexes
+}
+
+// markActiveIndexes records which indexes of the table can serve queries
+func (s *DynamoDBStorage) markActiveIndexes(table *dynamodb.TableDescription) {
+    s.indexMu.Lock()
+    defer s.indexMu.Unlock()
+
+    s.activeIndexes = make(map[string]bool)
+    for _, idx := range table.GlobalSecondaryIndexes {
+        if aws.StringValue(idx.IndexStatus) == dynamodb.IndexStatusActive {
+            s.activeIndexes[aws.StringValue(idx.IndexName)] = true
+        }
+    }
+}
+
+func (s *DynamoDBStorage) indexActive(name string) bool {
+    s.indexMu.RLock()
+    defer s.indexMu.RUnlock()
+    return s.activeIndexes[name]
+}
+
+// migrateIndexes adds the indexes an existing table is missing. DynamoDB
+// builds one index at a time, so this runs in the background and waits for
+// each index to become active before creating the next. Queries fall back
+// to scans until then.
+func (s *DynamoDBStorage) migrateIndexes(table *dynamodb.TableDescription) {
+    existing := make(map[string]bool)
+    for _, idx := range table.GlobalSecondaryIndexes {
+        existing[aws.StringValue(idx.IndexName)] = true
+    }
+
+    var missing []tableIndex
+    for _, idx := range tableIndexes {
+        if !existing[idx.Name] {
+            missing = append(missing, idx)
+        }
+    }
+
+    // Provisioned tables need throughput for every new index
+    var throughput *dynamodb.ProvisionedThroughput
+    provisioned := table.BillingModeSummary == nil ||
+        aws.StringValue(table.BillingModeSummary.BillingMode) == dynamodb.BillingModeProvisioned
+    if provisioned && table.ProvisionedThroughput != nil {
+        throughput = &dynamodb.ProvisionedThroughput{
+            ReadCapacityUnits:  table.ProvisionedThroughput.ReadCapacityUnits,
+            WriteCapacityUnits: table.ProvisionedThroughput.WriteCapacityUnits,
+        }
+    }
+
+    go func() {
+        // Wait for anything already being built before adding more
+        for _, idx := range table.GlobalSecondaryIndexes {
+            name := aws.StringValue(idx.IndexName)
+            if aws.StringValue(idx.IndexStatus) != dynamodb.IndexStatusActive {
+                if err := s.waitForIndex(name); err != nil {
+                    slog.Error("Failed waiting for index", "index", name, "error", err)
+                    return
+                }
+            }
+        }
+
+        for _, idx := range missing {
+            slog.Info("Adding index", "index", idx.Name, "table", s.tableName)
+
+            _, err := s.client.UpdateTable(&dynamodb.UpdateTableInput{
+                TableName:            aws.String(s.tableName),
+                AttributeDefinitions: idx.attributeDefinitions(),
+                GlobalSecondaryIndexUpdates: []*dynamodb.GlobalSecondaryIndexUpdate{
+                    {
+                        Create: &dynamodb.CreateGlobalSecondaryIndexAction{
+                            IndexName:             aws.String(idx.Name),
+                            KeySchema:             idx.keySchema(),
+                            Projection:            idx.projection(),
+                            ProvisionedThroughput: throughput,
+                        },
+                    },
+                },
+            })
+            if err != nil {
+                slog.Error("Failed to add index", "index", idx.Name, "error", err)
+                return
+            }
+
+            if err := s.waitForIndex(idx.Name); err != nil {
+                slog.Error("Failed waiting for index", "index", idx.Name, "error", err)
+                return
+            }
+            slog.Info("Index is active", "index", idx.Name)
+        }
+    }()
+}
+
+// waitForIndex polls the table until the index is active
+func (s *DynamoDBStorage) waitForIndex(name string) error {
+    for {
+        output, err := s.client.DescribeTable(&dynamodb.DescribeTableInput{
+            TableName: aws.String(s.tableName),
+        })
+        if err != nil {
+            return err
+        }
+
+        s.markActiveIndexes(output.Table)
+        if s.indexActive(name) {
+            return nil
+        }
+
+        time.Sleep(indexPollInterval)
+    }
+}
+
+// QueryByCountry returns up to limit proxies in the country checked at or
+// after since, most recently checked first
+func (s *DynamoDBStorage) QueryByCountry(ctx context.Context, country string, since time.Time, limit int) ([]models.ProxyData, error) {
+    if !s.indexActive(countryIndexName) {
+        proxies, err := s.scanProxies(ctx, ProxyFilter{Country: country})
+        if err != nil {
+            return nil, err
+        }
+        return sortByCountryIndex(proxies, country, since, limit), nil
+    }
+
+    return s.queryIndex(ctx, &dynamodb.QueryInput{
+        TableName:              aws.String(s.tableName),
+        IndexName:              aws.String(countryIndexName),
+        KeyConditionExpression: aws.String("country = :country AND last_checked >= :since"),
+        ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+            ":country": {S: aws.String(country)},
+            ":since":   {N: aws.String(fmt.Sprint(since.Unix()))},
+        },
+        ScanIndexForward: aws.Bool(false),
+    }, limit)
+}
+
+// QueryByProtocol returns up to limit proxies that work over the protocol
+// and whose latency is at most maxLatencyMs, fastest first. A maxLatencyMs of
+// 0 means no limit, with proxies of unknown latency last. Every protocol set
+// containing the protocol is its own partition of the index, so each is
+// queried and the results merged.
+func (s *DynamoDBStorage) QueryByProtocol(ctx context.Context, protocol string, maxLatencyMs float64, limit int) ([]models.ProxyData, error) {
+    protocol = strings.ToLower(protocol)
+    if !s.indexActive(protocolIndexName) {
+        proxies, err := s.scanProxies(ctx, ProxyFilter{Protocol: protocol})
+        if err != nil {
+            return nil, err
+        }
+        return sortByProtocolIndex(proxies, protocol, maxLatencyMs, limit), nil
+    }
+
+    var proxies []models.ProxyData
+    for _, key := range protocolKeysWith(protocol) {
+        input := &dynamodb.QueryInput{
+            TableName:              aws.String(s.tableName),
+            IndexName:              aws.String(protocolIndexName),
+            KeyConditionExpression: aws.String("protocol = :protocol"),
+            ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+                ":protocol": {S: aws.String(key)},
+            },
+            ScanIndexForward: aws.Bool(true),
+        }
+        if maxLatencyMs > 0 {
+            input.KeyConditionExpression = aws.String("protocol = :protocol AND latency_ms <= :max")
+            input.ExpressionAttributeValues[":max"] = &dynamodb.AttributeValue{N: aws.String(fmt.Sprint(maxLatencyMs))}
+        }
+
+        found, err := s.queryIndex(ctx, input, limit)
+        if err != nil {
+            return nil, err
+        }
+        proxies = append(proxies, found...)
+    }
+
+    // Items written before their protocols changed are still under the old key
+    return sortByProtocolIndex(proxies, protocol, maxLatencyMs, limit), nil
+}
+
+// queryIndex runs the query page by page until limit items are collected or
+// the index is exhausted. A limit of 0 collects everything.
+func (s *DynamoDBStorage) queryIndex(ctx context.Context, input *dynamodb.QueryInput, limit int) ([]models.ProxyData, error) {
+    var proxies []models.ProxyData
+
+    for {
+        if limit > 0 {
+            input.Limit = aws.Int64(int64(limit - len(proxies)))
+        }
+
+        output, err := s.client.QueryWithContext(ctx, input)
+        if err != nil {
+            return nil, fmt.Errorf("failed to query index %s: %v", aws.StringValue(input.IndexName), err)
+        }
+
+        for _, item := range output.Items {
+            proxy, err := unmarshalProxy(item)
+            if err != nil {
+                continue
+            }
+            proxies = append(proxies, *proxy)
+        }
+
+        if len(output.LastEvaluatedKey) == 0 || (limit > 0 && len(proxies) >= limit) {
+            return proxies, nil
+        }
+        input.ExclusiveStartKey = output.LastEvaluatedKey
+    }
+}
+
+// sortByCountryIndex applies the country index semantics to proxies already
+// filtered by country
+func sortByCountryIndex(proxies []models.ProxyData, country string, since time.Time, limit int) []models.ProxyData {
+    var result []models.ProxyData
+    for _, proxy := range proxies {
+        if proxy.Country == country && !proxy.LastChecked.Before(since) {
+            result = append(result, proxy)
+        }
+    }
+
+    sort.Slice(result, func(i, j int) bool {
+        return result[i].LastChecked.After(result[j].LastChecked)
+    })
+
+    if limit > 0 && len(result) > limit {
+        result = result[:limit]
+    }
+    return result
+}
+
+// sortByProtocolIndex applies the protocol index semantics to proxies
+// already filtered by protocol
+func sortByProtocolIndex(proxies []models.ProxyData, protocol string, maxLatencyMs float64, limit int) []models.ProxyData {
+    protocol = strings.ToLower(protocol)
+    var result []models.ProxyData
+    for _, proxy := range proxies {
+        if !strings.Contains("+"+protocolKey(&proxy)+"+", "+"+protocol+"+") {
+            continue
+        }
+        if maxLatencyMs > 0 && indexLatencyMs(&proxy) > maxLatencyMs {
+            continue
+        }
+        result = append(result, proxy)
+    }
+
+    sort.SliceStable(result, func(i, j int) bool {
+        return indexLatencyMs(&result[i]) < indexLatencyMs(&result[j])
+    })
+
+    if limit > 0 && len(result) > limit {
+        result = result[:limit]
+    }
+    return result
+}
+
+// protocolKey flattens the proxy's working protocols into its protocol index
+// key, most capable first, e.g. socks5+http. An index key holds one value, so
+// it names the whole set rather than a single protocol that would hide the
+// others.
+func protocolKey(p *models.ProxyData) string {
+    var protocols []string
+    for _, preferred := range models.ProtocolPreference {
+        for _, protocol := range p.EffectiveProtocols() {
+            if strings.EqualFold(protocol, preferred) {
+                protocols = append(protocols, preferred)
+                break
+            }
+        }
+    }
+    return strings.Join(protocols, "+")
+}
+
+// protocolKeysWith returns every protocol index key whose set contains the
+// protocol
+func protocolKeysWith(protocol string) []string {
+    var keys []string
+    for set := 1; set < 1<<len(models.ProtocolPreference); set++ {
+        var protocols []string
+        found := false
+        for i, candidate := range models.ProtocolPreference {
+            if set&(1<<i) == 0 {
+                continue
+            }
+            protocols = append(protocols, candidate)
+            found = found || candidate == protocol
+        }
+        if found {
+            keys = append(keys, strings.Join(protocols, "+"))
+        }
+    }
+    return keys
+}
+
+// indexLatencyMs is the latency the protocol index sorts a proxy by
+func indexLatencyMs(p *models.ProxyData) float64 {
+    if latency := p.EffectiveLatencyMs(); latency > 0 {
+        return latency
+    }
+    return unknownLatencyMs
+}
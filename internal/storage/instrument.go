@@ -0,0 +1,83 @@
+package storage
+
+import (
+    "github.com/aws/aws-sdk-go/aws"
+    "github.com/aws/aws-sdk-go/aws/request"
+    "github.com/aws/aws-sdk-go/service/dynamodb"
+
+    "proxy-system/internal/metrics"
+)
+
+// instrumentClient hooks request metrics into every call the client makes.
+// Consumed capacity is requested on every operation that can report it.
+func instrumentClient(client *dynamodb.DynamoDB) {
+    client.Handlers.Build.PushFront(requestConsumedCapacity)
+
+    client.Handlers.CompleteAttempt.PushBack(func(r *request.Request) {
+        if r.Error != nil && request.IsErrorThrottle(r.Error) {
+            metrics.ObserveDynamoThrottle(r.Operation.Name, 1)
+        }
+    })
+
+    client.Handlers.Complete.PushBack(func(r *request.Request) {
+        metrics.ObserveDynamoRequest(r.Operation.Name, r.Error != nil)
+        if r.Error == nil {
+            if units := consumedCapacity(r.Data); units > 0 {
+                metrics.ObserveDynamoCapacity(r.Operation.Name, units)
+            }
+        }
+    })
+}
+
+func requestConsumedCapacity(r *request.Request) {
+    total := aws.String(dynamodb.ReturnConsumedCapacityTotal)
+    switch input := r.Params.(type) {
+    case *dynamodb.GetItemInput:
+        input.ReturnConsumedCapacity = total
+    case *dynamodb.PutItemInput:
+        input.ReturnConsumedCapacity = total
+    case *dynamodb.UpdateItemInput:
+        input.ReturnConsumedCapacity = total
+    case *dynamodb.DeleteItemInput:
+        input.ReturnConsumedCapacity = total
+    case *dynamodb.BatchGetItemInput:
+        input.ReturnConsumedCapacity = total
+    case *dynamodb.BatchWriteItemInput:
+        input.ReturnConsumedCapacity = total
+    case *dynamodb.QueryInput:
+        input.ReturnConsumedCapacity = total
+    case *dynamodb.ScanInput:
+        input.ReturnConsumedCapacity = total
+    }
+}
+
+// consumedCapacity returns the capacity units reported in an operation's output
+func consumedCapacity(output interface{}) float64 {
+    var capacities []*dynamodb.ConsumedCapacity
+    switch out := output.(type) {
+    case *dynamodb.GetItemOutput:
+        capacities = append(capacities, out.ConsumedCapacity)
+    case *dynamodb.PutItemOutput:
+        capacities = append(capacities, out.ConsumedCapacity)
+    case *dynamodb.UpdateItemOutput:
+        capacities = append(capacities, out.ConsumedCapacity)
+    case *dynamodb.DeleteItemOutput:
+        capacities = append(capacities, out.ConsumedCapacity)
+    case *dynamodb.BatchGetItemOutput:
+        capacities = out.ConsumedCapacity
+    case *dynamodb.BatchWriteItemOutput:
+        capacities = out.ConsumedCapacity
+    case *dynamodb.QueryOutput:
+        capacities = append(capacities, out.ConsumedCapacity)
+    case *dynamodb.ScanOutput:
+        capacities = append(capacities, out.ConsumedCapacity)
+    }
+
+    var units float64
+    for _, capacity := range capacities {
+        if capacity != nil {
+            units += aws.Float64Value(capacity.CapacityUnits)
+        }
+    }
+    return units
+}
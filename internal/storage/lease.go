@@ -0,0 +1,122 @@
+package storage
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "math/rand"
+    "strconv"
+    "time"
+
+    "github.com/aws/aws-sdk-go/aws"
+    "github.com/aws/aws-sdk-go/aws/awserr"
+    "github.com/aws/aws-sdk-go/service/dynamodb"
+
+    "proxy-system/internal/models"
+)
+
+// ErrLeaseNotHeld is returned when releasing a lease the caller does not hold
+var ErrLeaseNotHeld = errors.New("lease not held by owner")
+
+// leaseCandidates returns the proxies that can be leased at now, shuffled so
+// concurrent workers do not all contend for the same few proxies. Proxies
+// with no working protocol, such as ones that failed validation, are left out.
+func leaseCandidates(proxies []models.ProxyData, now time.Time) []models.ProxyData {
+    candidates := proxies[:0]
+    for _, proxy := range proxies {
+        if proxy.Leased(now) || len(proxy.EffectiveProtocols()) == 0 {
+            continue
+        }
+        if proxy.Expired(now) {
+            continue
+        }
+        candidates = append(candidates, proxy)
+    }
+
+    rand.Shuffle(len(candidates), func(i, j int) {
+        candidates[i], candidates[j] = candidates[j], candidates[i]
+    })
+    return candidates
+}
+
+// AcquireLeases takes each lease with an UpdateItem conditioned on the proxy
+// being unleased, so a proxy another worker grabbed in the meantime is skipped
+func (s *DynamoDBStorage) AcquireLeases(ctx context.Context, owner string, filter ProxyFilter, count int, duration time.Duration, now time.Time) ([]models.ProxyData, error) {
+    proxies, err := s.QueryProxies(ctx, filter)
+    if err != nil {
+        return nil, err
+    }
+
+    expiry := now.Add(duration)
+    var leased []models.ProxyData
+
+    for _, candidate := range leaseCandidates(proxies, now) {
+        if len(leased) >= count {
+            break
+        }
+
+        output, err := s.client.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+            TableName: aws.String(s.tableName),
+            Key: map[string]*dynamodb.AttributeValue{
+                "proxy_key": {S: aws.String(candidate.GetKey())},
+            },
+            ConditionExpression: aws.String("attribute_exists(proxy_key) AND (attribute_not_exists(lease_expiry) OR lease_expiry <= :now)"),
+            UpdateExpression:    aws.String("SET lease_owner = :owner, lease_expiry = :expiry"),
+            ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+                ":now":    {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+                ":owner":  {S: aws.String(owner)},
+                ":expiry": {N: aws.String(strconv.FormatInt(expiry.Unix(), 10))},
+            },
+            ReturnValues: aws.String(dynamodb.ReturnValueAllNew),
+        })
+        if err != nil {
+            if isConditionalCheckFailed(err) {
+                continue
+            }
+            return leased, fmt.Errorf("failed to lease proxy %s: %v", candidate.GetKey(), err)
+        }
+
+        proxy, err := unmarshalProxy(output.Attributes)
+        if err != nil {
+            return leased, fmt.Errorf("failed to unmarshal leased proxy %s: %v", candidate.GetKey(), err)
+        }
+        leased = append(leased, *proxy)
+    }
+
+    return leased, nil
+}
+
+// ReleaseLease clears the lease only if owner still holds it and counts the
+// outcome in the same write
+func (s *DynamoDBStorage) ReleaseLease(ctx context.Context, proxyKey, owner string, success bool) error {
+    counter := "lease_failures"
+    if success {
+        counter = "lease_successes"
+    }
+
+    _, err := s.client.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+        TableName: aws.String(s.tableName),
+        Key: map[string]*dynamodb.AttributeValue{
+            "proxy_key": {S: aws.String(proxyKey)},
+        },
+        ConditionExpression: aws.String("lease_owner = :owner"),
+        UpdateExpression:    aws.String("REMOVE lease_owner, lease_expiry ADD " + counter + " :one"),
+        ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+            ":owner": {S: aws.String(owner)},
+            ":one":   {N: aws.String("1")},
+        },
+    })
+    if err != nil {
+        if isConditionalCheckFailed(err) {
+            return ErrLeaseNotHeld
+        }
+        return fmt.Errorf("failed to release lease on %s: %v", proxyKey, err)
+    }
+
+    return nil
+}
+
+func isConditionalCheckFailed(err error) bool {
+    aerr, ok := err.(awserr.Error)
+    return ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
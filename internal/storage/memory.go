@@ -0,0 +1,234 @@
+package storage
+
+import (
+    "context"
+    "sort"
+    "sync"
+    "time"
+
+    "proxy-system/internal/models"
+)
+
+// MemoryStorage is a thread-safe in-memory ProxyStore for tests and local runs.
+// Nothing is persisted once the process exits.
+type MemoryStorage struct {
+    mu        sync.RWMutex
+    proxies   map[string]models.ProxyData
+    freshness time.Duration
+}
+
+// NewMemoryStorage creates an empty store. Proxies expire freshness after
+// their last check, or never if it is 0.
+func NewMemoryStorage(freshness time.Duration) *MemoryStorage {
+    return &MemoryStorage{
+        proxies:   make(map[string]models.ProxyData),
+        freshness: freshness,
+    }
+}
+
+func (s *MemoryStorage) BatchGetProxies(ctx context.Context, proxyKeys []string) (map[string]*models.ProxyData, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    result := make(map[string]*models.ProxyData)
+    for _, key := range proxyKeys {
+        if proxy, ok := s.proxies[key]; ok {
+            proxy = copyProxy(proxy)
+            result[key] = &proxy
+        }
+    }
+
+    return result, nil
+}
+
+func (s *MemoryStorage) UpsertProxy(ctx context.Context, proxy *models.ProxyData) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    proxy.UpdatedAt = time.Now()
+    proxy.ExpiresAt = expiresAt(proxy, s.freshness)
+    s.store(*proxy)
+
+    return nil
+}
+
+func (s *MemoryStorage) BatchUpsertProxies(ctx context.Context, proxies []models.ProxyData) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    now := time.Now()
+    for _, proxy := range proxies {
+        proxy.UpdatedAt = now
+        proxy.ExpiresAt = expiresAt(&proxy, s.freshness)
+        s.store(proxy)
+    }
+
+    return nil
+}
+
+// store saves the proxy with the lease it has in storage, as upserts never
+// change a lease. The caller must hold the write lock.
+func (s *MemoryStorage) store(proxy models.ProxyData) {
+    stored := s.proxies[proxy.GetKey()]
+    proxy.LeaseOwner = stored.LeaseOwner
+    proxy.LeaseExpiry = stored.LeaseExpiry
+    proxy.LeaseSuccesses = stored.LeaseSuccesses
+    proxy.LeaseFailures = stored.LeaseFailures
+    s.proxies[proxy.GetKey()] = copyProxy(proxy)
+}
+
+func (s *MemoryStorage) RecordValidations(ctx context.Context, updates []ValidationUpdate) (int, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    now := time.Now()
+    written := 0
+    for _, update := range updates {
+        stored, ok := s.proxies[update.Proxy.GetKey()]
+        if !ok || !stored.ValidatedAt.Equal(update.Since) {
+            continue
+        }
+
+        p := update.Proxy
+        stored.ValidatedAt = p.ValidatedAt
+        stored.ValidProtocols = p.ValidProtocols
+        stored.ConnectLatencyMs = p.ConnectLatencyMs
+        stored.FirstByteLatencyMs = p.FirstByteLatencyMs
+        stored.ValidationError = p.ValidationError
+        stored.MeasuredAnonymity = p.MeasuredAnonymity
+        stored.HealthScore = p.HealthScore
+        stored.HealthSuccesses = p.HealthSuccesses
+        stored.HealthFailures = p.HealthFailures
+        stored.LastSuccessAt = p.LastSuccessAt
+        stored.UpdatedAt = now
+        stored.ExpiresAt = expiresAt(&stored, s.freshness)
+        s.proxies[stored.GetKey()] = copyProxy(stored)
+        written++
+    }
+
+    return written, nil
+}
+
+func (s *MemoryStorage) ScanProxies(ctx context.Context, startKey string, limit int) ([]models.ProxyData, string, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    keys := make([]string, 0, len(s.proxies))
+    for key := range s.proxies {
+        if key > startKey {
+            keys = append(keys, key)
+        }
+    }
+    sort.Strings(keys)
+
+    nextKey := ""
+    if limit > 0 && len(keys) > limit {
+        keys = keys[:limit]
+        nextKey = keys[limit-1]
+    }
+
+    proxies := make([]models.ProxyData, len(keys))
+    for i, key := range keys {
+        proxies[i] = copyProxy(s.proxies[key])
+    }
+
+    return proxies, nextKey, nil
+}
+
+func (s *MemoryStorage) QueryProxies(ctx context.Context, filter ProxyFilter) ([]models.ProxyData, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    var proxies []models.ProxyData
+    for _, proxy := range s.proxies {
+        if filter.Matches(&proxy) {
+            proxies = append(proxies, copyProxy(proxy))
+        }
+    }
+
+    return proxies, nil
+}
+
+func (s *MemoryStorage) QueryByCountry(ctx context.Context, country string, since time.Time, limit int) ([]models.ProxyData, error) {
+    proxies, err := s.QueryProxies(ctx, ProxyFilter{Country: country})
+    if err != nil {
+        return nil, err
+    }
+    return sortByCountryIndex(proxies, country, since, limit), nil
+}
+
+func (s *MemoryStorage) QueryByProtocol(ctx context.Context, protocol string, maxLatencyMs float64, limit int) ([]models.ProxyData, error) {
+    proxies, err := s.QueryProxies(ctx, ProxyFilter{Protocol: protocol})
+    if err != nil {
+        return nil, err
+    }
+    return sortByProtocolIndex(proxies, protocol, maxLatencyMs, limit), nil
+}
+
+func (s *MemoryStorage) PurgeExpired(ctx context.Context, now time.Time) (int, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    purged := 0
+    for key, proxy := range s.proxies {
+        if proxy.Expired(now) && !proxy.Leased(now) {
+            delete(s.proxies, key)
+            purged++
+        }
+    }
+
+    return purged, nil
+}
+
+func (s *MemoryStorage) AcquireLeases(ctx context.Context, owner string, filter ProxyFilter, count int, duration time.Duration, now time.Time) ([]models.ProxyData, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var matching []models.ProxyData
+    for _, proxy := range s.proxies {
+        if filter.Matches(&proxy) {
+            matching = append(matching, proxy)
+        }
+    }
+
+    var leased []models.ProxyData
+    for _, proxy := range leaseCandidates(matching, now) {
+        if len(leased) >= count {
+            break
+        }
+        proxy.LeaseOwner = owner
+        proxy.LeaseExpiry = now.Add(duration)
+        s.proxies[proxy.GetKey()] = proxy
+        leased = append(leased, copyProxy(proxy))
+    }
+
+    return leased, nil
+}
+
+func (s *MemoryStorage) ReleaseLease(ctx context.Context, proxyKey, owner string, success bool) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    proxy, ok := s.proxies[proxyKey]
+    if !ok || proxy.LeaseOwner != owner {
+        return ErrLeaseNotHeld
+    }
+
+    proxy.LeaseOwner = ""
+    proxy.LeaseExpiry = time.Time{}
+    if success {
+        proxy.LeaseSuccesses++
+    } else {
+        proxy.LeaseFailures++
+    }
+    s.proxies[proxyKey] = proxy
+
+    return nil
+}
+
+// copyProxy detaches the slices of a proxy so callers cannot mutate stored state
+func copyProxy(p models.ProxyData) models.ProxyData {
+    p.Protocols = append([]string(nil), p.Protocols...)
+    p.ValidProtocols = append([]string(nil), p.ValidProtocols...)
+    return p
+}
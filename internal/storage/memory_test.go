@@ -0,0 +1,50 @@
+package storage
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    "proxy-system/internal/models"
+)
+
+func TestMemoryRecordValidations(t *testing.T) {
+    ctx := context.Background()
+    s := NewMemoryStorage(time.Hour)
+
+    since := time.Now().Add(-time.Hour)
+    scanned := models.ProxyData{IP: "10.0.0.1", Port: "8080", Country: "US", ValidatedAt: since}
+    raced := models.ProxyData{IP: "10.0.0.2", Port: "8080", Country: "US", ValidatedAt: since}
+    if err := s.BatchUpsertProxies(ctx, []models.ProxyData{scanned, raced}); err != nil {
+        t.Fatal(err)
+    }
+
+    // The update cycle writes both after the revalidation scanned them, but
+    // only validates the second one
+    scanned.Country, raced.Country = "DE", "DE"
+    raced.ValidatedAt = time.Now()
+    if err := s.BatchUpsertProxies(ctx, []models.ProxyData{scanned, raced}); err != nil {
+        t.Fatal(err)
+    }
+
+    var updates []ValidationUpdate
+    for _, key := range []string{"10.0.0.1", "10.0.0.2"} {
+        result := models.ProxyData{IP: key, Port: "8080", Country: "US", ValidatedAt: time.Now(), ValidationError: "timeout"}
+        updates = append(updates, ValidationUpdate{Proxy: result, Since: since})
+    }
+    written, err := s.RecordValidations(ctx, updates)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if written != 1 {
+        t.Errorf("written = %d, want only the proxy not validated since", written)
+    }
+
+    got, _ := s.BatchGetProxies(ctx, []string{scanned.GetKey(), raced.GetKey()})
+    if p := got[scanned.GetKey()]; p.ValidationError != "timeout" || p.Country != "DE" {
+        t.Errorf("revalidated proxy has ValidationError %q and Country %q, want the new result and the newer provider data", p.ValidationError, p.Country)
+    }
+    if p := got[raced.GetKey()]; p.ValidationError != "" {
+        t.Errorf("proxy validated since the scan was overwritten with %q", p.ValidationError)
+    }
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+    "context"
+    "fmt"
+    "time"
+
+    "proxy-system/internal/config"
+    "proxy-system/internal/models"
+)
+
+// ProxyStore is the persistence layer used by the proxy service
+type ProxyStore interface {
+    // BatchGetProxies returns the stored proxies for the given keys, keyed by proxy key.
+    // Keys that are not stored are absent from the result.
+    BatchGetProxies(ctx context.Context, proxyKeys []string) (map[string]*models.ProxyData, error)
+    // UpsertProxy and BatchUpsertProxies write everything about a proxy except
+    // its lease, which only AcquireLeases and ReleaseLease change
+    UpsertProxy(ctx context.Context, proxy *models.ProxyData) error
+    BatchUpsertProxies(ctx context.Context, proxies []models.ProxyData) error
+    // RecordValidations writes only the validation results and health of each
+    // proxy, and only where the stored ValidatedAt still equals Since. Proxies
+    // validated again since, or no longer stored, are skipped. It returns how
+    // many were written.
+    RecordValidations(ctx context.Context, updates []ValidationUpdate) (int, error)
+    // ScanProxies returns up to limit proxies starting after startKey, along with
+    // the key to resume from. An empty next key means the scan is complete.
+    ScanProxies(ctx context.Context, startKey string, limit int) ([]models.ProxyData, string, error)
+    // QueryProxies returns every stored proxy matching the filter
+    QueryProxies(ctx context.Context, filter ProxyFilter) ([]models.ProxyData, error)
+    // QueryByCountry returns up to limit proxies in the country checked at or
+    // after since, most recently checked first. A limit of 0 returns all of them.
+    QueryByCountry(ctx context.Context, country string, since time.Time, limit int) ([]models.ProxyData, error)
+    // QueryByProtocol returns up to limit proxies that work over the protocol
+    // and whose latency is at most maxLatencyMs (0 for any), fastest first with
+    // unknown latencies last
+    QueryByProtocol(ctx context.Context, protocol string, maxLatencyMs float64, limit int) ([]models.ProxyData, error)
+    // PurgeExpired deletes every unleased proxy whose expiry is before now and
+    // returns how many were deleted
+    PurgeExpired(ctx context.Context, now time.Time) (int, error)
+    // AcquireLeases checks out up to count unleased proxies matching the filter
+    // for owner until now+duration. Each lease is taken with a conditional
+    // write, so concurrent workers never get the same proxy.
+    AcquireLeases(ctx context.Context, owner string, filter ProxyFilter, count int, duration time.Duration, now time.Time) ([]models.ProxyData, error)
+    // ReleaseLease gives back a lease held by owner and records whether the
+    // proxy worked. It returns ErrLeaseNotHeld if owner does not hold the lease.
+    ReleaseLease(ctx context.Context, proxyKey, owner string, success bool) error
+}
+
+// ValidationUpdate is a new validation result for a stored proxy
+type ValidationUpdate struct {
+    Proxy models.ProxyData // The stored proxy with the result and health applied
+    Since time.Time        // Its ValidatedAt as read, before the result was applied
+}
+
+// expiresAt returns when a proxy goes stale: freshness after the provider's
+// check until we validate the proxy ourselves, and freshness after our last
+// successful validation from then on, however often a source still lists it.
+// Failed validations do not extend it. A zero freshness never expires.
+func expiresAt(p *models.ProxyData, freshness time.Duration) time.Time {
+    if freshness <= 0 {
+        return time.Time{}
+    }
+
+    seen := p.LastChecked
+    if !p.ValidatedAt.IsZero() {
+        seen = p.LastSuccessAt
+        if seen.IsZero() {
+            // Validated but never passed, as far as we recorded
+            seen = p.CreatedAt
+        }
+    }
+    if seen.IsZero() || seen.Unix() <= 0 {
+        seen = time.Now()
+    }
+
+    return seen.Add(freshness)
+}
+
+// NewProxyStore creates the storage backend selected in the config
+func NewProxyStore(cfg *config.Config) (ProxyStore, error) {
+    switch cfg.StorageBackend {
+    case config.StorageDynamoDB:
+        store, err := NewDynamoDBStorage(cfg)
+        if err != nil {
+            return nil, err
+        }
+        return store, nil
+    case config.StorageMemory:
+        return NewMemoryStorage(cfg.ProxyTTL), nil
+    default:
+        return nil, fmt.Errorf("unknown storage backend: %s", cfg.StorageBackend)
+    }
+}